@@ -18,6 +18,9 @@ type BrowserService interface {
 	// OpenUrlWithBrowser launches the given url with the given browser
 	OpenUrlWithBrowser(url string, browser *Browser) error
 
+	// GetLaunchCommand returns the command (and its arguments) OpenUrlWithBrowser runs for the given url and browser
+	GetLaunchCommand(url string, browser *Browser) []string
+
 	// AreWeTheDefaultBrowser returns true if Linkquisition is the default browser
 	AreWeTheDefaultBrowser() bool
 
@@ -2,15 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/url"
 	"os"
-	"path/filepath"
 	"plugin"
 	"strings"
 
+	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
 
@@ -22,13 +23,22 @@ const logDirPerms = 0755
 const logFilePerms = 0644
 
 type Application struct {
-	GtkApp          *gtk.Application
-	XdgService      freedesktop.XdgService
-	BrowserService  linkquisition.BrowserService
-	SettingsService linkquisition.SettingsService
+	GtkApp            *gtk.Application
+	XdgService        freedesktop.XdgService
+	BrowserService    linkquisition.BrowserService
+	SettingsService   linkquisition.SettingsService
+	SourceAppDetector linkquisition.SourceAppDetector
+	NetworkProbe      linkquisition.NetworkProbe
+	RuleStatsService  linkquisition.RuleStatsService
 
 	Logger  *slog.Logger
-	plugins []linkquisition.Plugin
+	plugins []loadedPlugin
+}
+
+// loadedPlugin is a plugin that has been loaded and set up, along with the path it was configured with
+type loadedPlugin struct {
+	linkquisition.Plugin
+	Path string
 }
 
 func NewApplication() *Application {
@@ -53,37 +63,33 @@ func NewApplication() *Application {
 	}
 
 	logger := setupLogger(settingsService)
+	settingsService.Logger = logger
 
 	pluginServiceProvider := linkquisition.NewPluginServiceProvider(logger, settingsService.GetSettings())
 
 	a := &Application{
-		GtkApp:          gtkApp,
-		BrowserService:  browserService,
-		SettingsService: settingsService,
-		Logger:          logger,
-		plugins:         setupPlugins(settingsService, pluginServiceProvider, logger),
+		GtkApp:            gtkApp,
+		BrowserService:    browserService,
+		SettingsService:   settingsService,
+		SourceAppDetector: &freedesktop.SourceAppDetector{},
+		NetworkProbe:      &freedesktop.NetworkProbe{},
+		RuleStatsService:  &freedesktop.RuleStatsService{FolderPath: settingsService.GetLogFolderPath(), Logger: logger},
+		Logger:            logger,
+		plugins:           setupPlugins(settingsService, pluginServiceProvider, logger),
 	}
 
-	return a
-}
+	settingsService.PluginSchemas = getPluginSchemas(a.plugins)
 
-func resolvePluginPath(name string, folders []string) (string, bool) {
-	for _, folder := range folders {
-		candidate := filepath.Join(folder, name)
-		if _, err := os.Stat(candidate); err == nil {
-			return candidate, true
-		}
-	}
-	return "", false
+	return a
 }
 
 func setupPlugins(
 	settingsService linkquisition.SettingsService,
 	pluginServiceProvider linkquisition.PluginServiceProvider,
 	logger *slog.Logger,
-) []linkquisition.Plugin {
+) []loadedPlugin {
 	settings := settingsService.GetSettings()
-	var plugins []linkquisition.Plugin
+	var plugins []loadedPlugin
 
 	for _, pluginSettings := range settings.Plugins {
 		if pluginSettings.IsDisabled {
@@ -91,18 +97,10 @@ func setupPlugins(
 			continue
 		}
 
-		pluginPath := pluginSettings.Path
-		if !strings.HasSuffix(pluginPath, ".so") {
-			pluginPath += ".so"
-		}
-
-		if _, err := os.Stat(pluginPath); err != nil {
-			resolved, ok := resolvePluginPath(pluginPath, settingsService.GetPluginFolderPaths())
-			if !ok {
-				logger.Error("Error loading plugin: not found in any XDG data path", "plugin", pluginSettings.Path)
-				continue
-			}
-			pluginPath = resolved
+		pluginPath, ok := linkquisition.ResolvePluginPath(pluginSettings.Path, settingsService.GetPluginFolderPaths())
+		if !ok {
+			logger.Error("Error loading plugin: not found in any XDG data path", "plugin", pluginSettings.Path)
+			continue
 		}
 
 		plug, err := plugin.Open(pluginPath)
@@ -114,7 +112,7 @@ func setupPlugins(
 		if p, err := setupPlugin(plug, pluginSettings.Settings, pluginServiceProvider); err != nil {
 			logger.Error("Error setting up plugin", "plugin", pluginSettings.Path, "error", err.Error())
 		} else {
-			plugins = append(plugins, p)
+			plugins = append(plugins, loadedPlugin{Plugin: p, Path: pluginSettings.Path})
 		}
 	}
 
@@ -186,7 +184,11 @@ type uiState struct {
 	showConfigurator bool
 	urlToOpen        string
 	browsers         []linkquisition.Browser
+	copyToClipboard  bool // true when the URL is to be copied to the clipboard instead of opening it
 	done             bool // true when the action is already handled (no UI needed)
+
+	// settings are the ones the URL was matched with, for the picker to use as well
+	settings *linkquisition.Settings
 }
 
 // prepareUIState resolves which UI to show and pre-fetches browsers when needed.
@@ -203,17 +205,38 @@ func (a *Application) prepareUIState(args []string) (*uiState, error) {
 		return &uiState{done: true}, nil
 	}
 
+	env := a.getMatchEnvironment()
+
 	for _, plug := range a.plugins {
 		urlToOpen = plug.ModifyUrl(urlToOpen)
 	}
 
 	isConfigured, configErr := a.SettingsService.IsConfigured()
-	if configErr != nil {
+	var parseErr *linkquisition.SettingsParseError
+	switch {
+	case errors.As(configErr, &parseErr):
+		a.Logger.Error(
+			"the config-file can't be used and is ignored until fixed",
+			"file", parseErr.Path, "line", parseErr.Line, "column", parseErr.Column, "error", parseErr.Err.Error(),
+		)
+	case configErr != nil:
 		a.Logger.Warn("configuration error", "error", configErr.Error())
 	}
 
+	// the settings are read once and then used as they are for the rest of the run, the picker included
+	settings := a.SettingsService.GetSettings()
+	settings.Environment = env
+
 	if isConfigured {
-		return a.resolveConfiguredBrowsers(urlToOpen)
+		return a.resolveConfiguredBrowsers(settings, urlToOpen)
+	}
+
+	// the rules locked by a policy are in effect even before the user has configured anything
+	matcher, _ := settings.GetMatcher()
+	if result, matchErr := matcher.Match(urlToOpen); matchErr == nil && result.Rule.Locked {
+		if state := a.actOnMatch(settings, urlToOpen, result); state != nil {
+			return state, nil
+		}
 	}
 
 	b, err := a.BrowserService.GetAvailableBrowsers()
@@ -221,17 +244,126 @@ func (a *Application) prepareUIState(args []string) (*uiState, error) {
 		return nil, err
 	}
 	a.Logger.Warn("browsers not configured, falling back to system settings")
-	return &uiState{urlToOpen: urlToOpen, browsers: b}, nil
+	return &uiState{urlToOpen: urlToOpen, browsers: b, settings: settings}, nil
+}
+
+// getMatchEnvironment resolves the circumstances the browser-rules are matched in, such as the app the link came from
+func (a *Application) getMatchEnvironment() linkquisition.MatchEnvironment {
+	env := linkquisition.MatchEnvironment{
+		Clock:   linkquisition.SystemClock{},
+		Network: a.NetworkProbe,
+	}
+
+	if sourceApp, err := a.SourceAppDetector.DetectSourceApp(); err != nil {
+		a.Logger.Warn("unable to detect the source app", "error", err.Error())
+	} else {
+		a.Logger.Debug(
+			"detected the source app",
+			"desktopFile", sourceApp.DesktopFile,
+			"processes", strings.Join(sourceApp.Processes, " < "),
+		)
+		env.SourceApp = sourceApp
+	}
+
+	return env
+}
+
+func (a *Application) resolveConfiguredBrowsers(settings *linkquisition.Settings, urlToOpen string) (*uiState, error) {
+	now := settings.Environment.Clock.Now()
+
+	if removed := settings.RemoveExpiredRules(now); removed > 0 {
+		a.Logger.Info("removing expired browser-rules", "count", removed)
+		change := linkquisition.SettingsChange{
+			Kind:        linkquisition.SettingsChangeExpire,
+			Description: fmt.Sprintf("removed %d expired rules", removed),
+		}
+		writeErr := a.SettingsService.UpdateSettings(change, func(current *linkquisition.Settings) error {
+			current.RemoveExpiredRules(now)
+			return nil
+		})
+		if writeErr != nil {
+			a.Logger.Warn("unable to remove the expired browser-rules", "error", writeErr.Error())
+		}
+	}
+
+	if _, compileErr := settings.GetMatcher(); compileErr != nil {
+		a.Logger.Warn("some browser-rules are invalid and will be ignored", "error", compileErr.Error())
+	}
+
+	matcher, _ := settings.GetMatcher()
+
+	if result, matchErr := matcher.Match(urlToOpen); matchErr == nil {
+		if state := a.actOnMatch(settings, urlToOpen, result); state != nil {
+			return state, nil
+		}
+	}
+	return &uiState{urlToOpen: urlToOpen, browsers: settings.GetSelectableBrowsers(), settings: settings}, nil
 }
 
-func (a *Application) resolveConfiguredBrowsers(urlToOpen string) (*uiState, error) {
-	if browser, matchErr := a.SettingsService.GetSettings().GetMatchingBrowser(urlToOpen); matchErr == nil {
-		a.Logger.Debug(fmt.Sprintf("found a matching browser-rule for browser `%s` with URL `%s`", browser.Name, urlToOpen))
-		if a.BrowserService.OpenUrlWithBrowser(urlToOpen, browser) == nil {
-			return &uiState{done: true}, nil
+// actOnMatch carries out the action of the matching rule. It returns nil if the picker should be shown instead.
+func (a *Application) actOnMatch(
+	settings *linkquisition.Settings,
+	urlToOpen string,
+	result *linkquisition.MatchResult,
+) *uiState {
+	if result.Url != urlToOpen {
+		a.Logger.Debug(fmt.Sprintf("the matching rule rewrote URL `%s` to `%s`", urlToOpen, result.Url))
+	}
+
+	switch result.Action {
+	case linkquisition.RuleActionBlock:
+		a.Logger.Warn("refusing to open a blocked URL", "url", urlToOpen, "rule", result.RuleIndex, "value", result.Rule.Value)
+		return &uiState{done: true}
+	case linkquisition.RuleActionAsk:
+		a.Logger.Debug(fmt.Sprintf("a rule asks to always pick the browser for URL `%s`", urlToOpen))
+		return nil
+	case linkquisition.RuleActionCopy:
+		a.Logger.Debug(fmt.Sprintf("copying URL `%s` to the clipboard as instructed by a rule", result.Url))
+		return &uiState{urlToOpen: result.Url, copyToClipboard: true}
+	case linkquisition.RuleActionSystemDefault:
+		// the URL would just come back to us
+		if a.BrowserService.AreWeTheDefaultBrowser() {
+			a.Logger.Warn("unable to hand the URL to the system default browser as it's Linkquisition itself", "url", urlToOpen)
+			return nil
 		}
+		if err := a.BrowserService.OpenUrlWithDefaultBrowser(result.Url); err != nil {
+			a.Logger.Warn("unable to open the URL with the system default browser", "error", err.Error())
+			return nil
+		}
+		return &uiState{done: true}
+	}
+
+	browser := &result.Browser
+	a.Logger.Debug(fmt.Sprintf("found a matching browser-rule for browser `%s` with URL `%s`", browser.Name, result.Url))
+	if result.TopLevelRule == nil {
+		a.recordRuleHit(settings, result)
+	}
+	if a.BrowserService.OpenUrlWithBrowser(result.Url, browser) != nil {
+		return nil
+	}
+
+	return &uiState{done: true}
+}
+
+// recordRuleHit updates the usage statistics of the rules; failing to do so is not worth failing to open the URL for
+func (a *Application) recordRuleHit(settings *linkquisition.Settings, result *linkquisition.MatchResult) {
+	err := a.RuleStatsService.UpdateRuleStats(func(stats *linkquisition.RuleStats) error {
+		now := settings.Environment.Clock.Now()
+		stats.Sync(settings, now)
+		stats.RecordHit(&result.Browser, result.Rule, now)
+		return nil
+	})
+	if err != nil {
+		a.Logger.Warn("unable to update the rule-stats", "error", err.Error())
+	}
+}
+
+// refreshSubscriptions fetches the subscriptions due for a refresh, for the links opened from then on; a failure leaves
+// the rules fetched previously in effect
+func (a *Application) refreshSubscriptions() {
+	if err := a.SettingsService.RefreshSubscriptions(false); err != nil {
+		a.Logger.Warn("unable to refresh the subscriptions", "error", err.Error())
 	}
-	return &uiState{urlToOpen: urlToOpen, browsers: a.SettingsService.GetSettings().GetSelectableBrowsers()}, nil
 }
 
 func (a *Application) Run(_ context.Context) error {
@@ -243,20 +375,56 @@ func (a *Application) Run(_ context.Context) error {
 		return nil
 	}
 
+	// --- Non-UI path: explain how a URL would be handled ---
+	if len(args) >= 2 && args[1] == "explain" {
+		return a.Explain(os.Stdout, args[2:])
+	}
+
+	// --- Non-UI path: config-file maintenance ---
+	if len(args) >= 2 && args[1] == "config" {
+		return a.Config(os.Stdout, args[2:])
+	}
+
+	// --- Non-UI path: switching between the modes ---
+	if len(args) >= 2 && args[1] == "mode" {
+		return a.Mode(os.Stdout, args[2:])
+	}
+
+	// --- Non-UI path: browser-rule maintenance ---
+	if len(args) >= 2 && args[1] == "rules" {
+		return a.Rules(os.Stdout, args[2:])
+	}
+
+	// --- Non-UI path: shared rule subscriptions ---
+	if len(args) >= 2 && args[1] == "subscriptions" {
+		return a.Subscriptions(os.Stdout, args[2:])
+	}
+
 	state, err := a.prepareUIState(args)
 	if err != nil {
 		return err
 	}
+
+	// the subscriptions are refreshed only once the link has been handled, so that fetching them never holds it up
+	defer a.refreshSubscriptions()
+
 	if state.done {
 		return nil
 	}
 
 	// --- GTK4 event loop ---
 	a.GtkApp.ConnectActivate(func() {
+		if state.copyToClipboard {
+			gdk.DisplayGetDefault().Clipboard().SetText(state.urlToOpen)
+			return
+		}
 		if state.showConfigurator {
 			NewConfigurator(a.GtkApp, a.BrowserService, a.SettingsService).Run()
 		} else {
-			NewBrowserPicker(a.GtkApp, a.BrowserService, state.browsers, a.SettingsService).Run(context.Background(), state.urlToOpen)
+			NewBrowserPicker(a.GtkApp, a.BrowserService, state.browsers, state.settings, a.SettingsService).Run(
+				context.Background(),
+				state.urlToOpen,
+			)
 		}
 	})
 
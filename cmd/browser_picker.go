@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
@@ -23,6 +24,7 @@ type BrowserPicker struct {
 	gtkApp          *gtk.Application
 	browserService  linkquisition.BrowserService
 	browsers        []linkquisition.Browser
+	settings        *linkquisition.Settings
 	settingsService linkquisition.SettingsService
 }
 
@@ -30,20 +32,40 @@ func NewBrowserPicker(
 	gtkApp *gtk.Application,
 	browserService linkquisition.BrowserService,
 	browsers []linkquisition.Browser,
+	settings *linkquisition.Settings,
 	settingsService linkquisition.SettingsService,
 ) *BrowserPicker {
 	return &BrowserPicker{
 		gtkApp:          gtkApp,
 		browserService:  browserService,
 		browsers:        browsers,
+		settings:        settings,
 		settingsService: settingsService,
 	}
 }
 
 func (picker *BrowserPicker) Run(_ context.Context, urlToOpen string) {
 	var remember bool
-	// TODO give user the option to choose between site and domain (and later on regex, too)
-	rememberMatchType := linkquisition.BrowserMatchTypeSite
+	rememberOptions := linkquisition.NewURL(urlToOpen).GetRuleSuggestions()
+	rememberChoice := gtk.NewDropDownFromStrings(describeRules(rememberOptions))
+	rememberChoice.SetSensitive(false)
+
+	rememberFor := gtk.NewDropDownFromStrings(describeRuleLifetimes(ruleLifetimes))
+	rememberFor.SetSensitive(false)
+
+	rememberedRule := func() *linkquisition.BrowserMatch {
+		selected := int(rememberChoice.Selected())
+		if !remember || selected >= len(rememberOptions) {
+			return nil
+		}
+
+		rule := rememberOptions[selected]
+		if lifetime := int(rememberFor.Selected()); lifetime < len(ruleLifetimes) {
+			rule.ExpiresAt = ruleLifetimes[lifetime].expiresAt(time.Now())
+		}
+
+		return &rule
+	}
 
 	win := gtk.NewApplicationWindow(picker.gtkApp)
 	win.SetTitle("Linkquisition")
@@ -55,7 +77,7 @@ func (picker *BrowserPicker) Run(_ context.Context, urlToOpen string) {
 	var buttons []*gtk.Button
 
 	for i := range picker.browsers {
-		btn := picker.makeBrowserButton(picker.browsers[i], urlToOpen, &remember, &rememberMatchType)
+		btn := picker.makeBrowserButton(picker.browsers[i], urlToOpen, rememberedRule)
 		buttons = append(buttons, btn)
 		vbox.Append(btn)
 	}
@@ -71,16 +93,29 @@ func (picker *BrowserPicker) Run(_ context.Context, urlToOpen string) {
 	urlRow.Append(urlEntry)
 	vbox.Append(urlRow)
 
-	// Remember checkbox
-	uto := linkquisition.NewURL(urlToOpen)
-	site, _ := uto.GetSite()
-	check := gtk.NewCheckButtonWithLabel("Remember this choice with " + site)
+	// Remember checkbox with the choice of the rule to remember
+	check := gtk.NewCheckButtonWithLabel("Remember this choice with")
 	check.ConnectToggled(func() {
 		remember = check.Active()
+		rememberChoice.SetSensitive(remember)
+		rememberFor.SetSensitive(remember)
 	})
-	vbox.Append(check)
 
-	if !picker.settingsService.GetSettings().Ui.HideKeyboardGuideLabel {
+	switch {
+	case picker.settings.IsLocked(urlToOpen):
+		// a rule locked by a policy asks for the browser: a remembered choice would never be used
+		lockedLabel := gtk.NewLabel("The browser for this URL is managed by a policy and can't be remembered")
+		lockedLabel.SetSensitive(false)
+		vbox.Append(lockedLabel)
+	case len(rememberOptions) > 0:
+		rememberRow := gtk.NewBox(gtk.OrientationHorizontal, spacingSmall)
+		rememberRow.Append(check)
+		rememberRow.Append(rememberChoice)
+		rememberRow.Append(rememberFor)
+		vbox.Append(rememberRow)
+	}
+
+	if !picker.settings.Ui.HideKeyboardGuideLabel {
 		vbox.Append(gtk.NewLabel("Press 'ENTER' to pick first, 'ESC' to quit, 'ctrl+c' to copy URL to clipboard"))
 	}
 
@@ -130,8 +165,7 @@ func (picker *BrowserPicker) Run(_ context.Context, urlToOpen string) {
 func (picker *BrowserPicker) makeBrowserButton(
 	browser linkquisition.Browser,
 	urlToOpen string,
-	remember *bool,
-	rememberMatchType *string,
+	rememberedRule func() *linkquisition.BrowserMatch,
 ) *gtk.Button {
 	btn := gtk.NewButton()
 	box := gtk.NewBox(gtk.OrientationHorizontal, spacingLarge)
@@ -157,21 +191,26 @@ func (picker *BrowserPicker) makeBrowserButton(
 	btn.SetChild(box)
 
 	btn.ConnectClicked(func() {
-		fmt.Printf("Opening URL with browser: %s; remember the choice: %v\n", browser.Name, *remember)
-
-		settings := picker.settingsService.GetSettings()
-
-		if *remember {
-			uto := linkquisition.NewURL(urlToOpen)
-			matchValue, _ := uto.GetDomain()
+		rule := rememberedRule()
+		fmt.Printf("Opening URL with browser: %s; remember the choice: %v\n", browser.Name, rule != nil)
 
-			if *rememberMatchType == linkquisition.BrowserMatchTypeSite {
-				matchValue, _ = uto.GetSite()
+		if rule != nil {
+			// the rule is added to the current settings, so that a choice remembered meanwhile in another window isn't
+			// lost
+			change := linkquisition.SettingsChange{
+				Kind:        linkquisition.SettingsChangeRemember,
+				Description: fmt.Sprintf("remembered %s `%s` for %s", rule.Type, rule.Value, browser.Name),
+				Browser:     browser.Command,
+				Rule:        rule,
 			}
-
-			settings.AddRuleToBrowser(&browser, *rememberMatchType, matchValue)
-			if writeErr := picker.settingsService.WriteSettings(settings); writeErr != nil {
-				fmt.Printf("Failed to write settings: %v\n", writeErr)
+			updateErr := picker.settingsService.UpdateSettings(change, func(settings *linkquisition.Settings) error {
+				if !settings.IsLocked(urlToOpen) {
+					settings.AddMatchToBrowser(&browser, *rule)
+				}
+				return nil
+			})
+			if updateErr != nil {
+				fmt.Printf("Failed to write settings: %v\n", updateErr)
 			}
 		}
 
@@ -181,3 +220,67 @@ func (picker *BrowserPicker) makeBrowserButton(
 
 	return btn
 }
+
+// describeRules returns the human-readable labels of the given rules for the "remember" -dropdown
+func describeRules(rules []linkquisition.BrowserMatch) []string {
+	labels := make([]string, len(rules))
+
+	for i := range rules {
+		switch rules[i].Type {
+		case linkquisition.BrowserMatchTypeDomain:
+			labels[i] = "all of " + rules[i].Value
+		case linkquisition.BrowserMatchTypePathPrefix:
+			labels[i] = "path " + rules[i].Value
+		case linkquisition.BrowserMatchTypeQuery:
+			labels[i] = "query " + rules[i].Value
+		default:
+			labels[i] = rules[i].Value
+		}
+	}
+
+	return labels
+}
+
+// ruleLifetime is an option for how long a remembered choice is kept
+type ruleLifetime struct {
+	label     string
+	expiresAt func(now time.Time) *time.Time
+}
+
+var ruleLifetimes = []ruleLifetime{
+	{
+		label:     "forever",
+		expiresAt: func(time.Time) *time.Time { return nil },
+	},
+	{
+		label: "for today",
+		expiresAt: func(now time.Time) *time.Time {
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+			return &midnight
+		},
+	},
+	{
+		label: "for 7 days",
+		expiresAt: func(now time.Time) *time.Time {
+			expiresAt := now.AddDate(0, 0, 7) //nolint:mnd
+			return &expiresAt
+		},
+	},
+	{
+		label: "for 30 days",
+		expiresAt: func(now time.Time) *time.Time {
+			expiresAt := now.AddDate(0, 0, 30) //nolint:mnd
+			return &expiresAt
+		},
+	},
+}
+
+func describeRuleLifetimes(lifetimes []ruleLifetime) []string {
+	labels := make([]string, len(lifetimes))
+
+	for i := range lifetimes {
+		labels[i] = lifetimes[i].label
+	}
+
+	return labels
+}
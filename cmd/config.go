@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/strobotti/linkquisition"
+)
+
+// Config runs the given `config` subcommand
+func (a *Application) Config(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New(
+			"usage: linkquisition config lint [--json] [--subscription] [file] | config schema | config history [--json] | " +
+				"config undo [N]",
+		)
+	}
+
+	switch args[0] {
+	case "lint":
+		return a.lintConfig(w, args[1:])
+	case "schema":
+		return a.printConfigSchema(w, args[1:])
+	case "history":
+		return a.printConfigHistory(w, args[1:])
+	case "undo":
+		return a.undoConfigChanges(w, args[1:])
+	default:
+		return fmt.Errorf("unknown config subcommand `%s`", args[0])
+	}
+}
+
+// lintConfig validates the config-file, or the given file, and prints the problems found. An error is returned if
+// any of the problems is an error rather than a warning.
+func (a *Application) lintConfig(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("config lint", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	asJson := flags.Bool("json", false, "output as JSON")
+	subscription := flags.Bool("subscription", false, "check the file as one shared through a subscription")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 || (*subscription && flags.NArg() == 0) {
+		return errors.New("usage: linkquisition config lint [--json] [--subscription] [file]")
+	}
+
+	path := a.SettingsService.GetConfigFilePath()
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	diagnostics, err := lintConfigFile(path, a.SettingsService.GetPluginFolderPaths(), *subscription)
+	if err != nil {
+		return err
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(diagnostics); encodeErr != nil {
+			return encodeErr
+		}
+	} else {
+		for _, diagnostic := range diagnostics {
+			fmt.Fprintf(w, "%s:%s\n", path, diagnostic)
+		}
+	}
+
+	if linkquisition.HasErrors(diagnostics) {
+		return fmt.Errorf("the config-file `%s` has errors", path)
+	}
+
+	return nil
+}
+
+func lintConfigFile(path string, pluginFolderPaths []string, subscription bool) ([]linkquisition.Diagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open config-file `%s` for reading: %v", path, err)
+	}
+
+	var diagnostics []linkquisition.Diagnostic
+	if subscription {
+		diagnostics = linkquisition.LintSubscription(data)
+	} else {
+		diagnostics = linkquisition.LintSettings(data, pluginFolderPaths)
+	}
+	if diagnostics == nil {
+		diagnostics = []linkquisition.Diagnostic{}
+	}
+
+	return diagnostics, nil
+}
+
+// printConfigSchema prints the JSON Schema of the config-file, including the schemas of the loaded plugins' settings
+func (a *Application) printConfigSchema(w io.Writer, args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: linkquisition config schema")
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(linkquisition.GetSettingsSchema(getPluginSchemas(a.plugins)))
+}
+
+// getPluginSchemas returns the schemas of the settings of the plugins providing one, keyed by the path of the plugin
+func getPluginSchemas(plugins []loadedPlugin) map[string]map[string]any {
+	schemas := map[string]map[string]any{}
+
+	for _, p := range plugins {
+		if provider, ok := p.Plugin.(linkquisition.SchemaProvider); ok {
+			schemas[p.Path] = provider.GetSettingsSchema()
+		}
+	}
+
+	return schemas
+}
+
+type configHistoryEntry struct {
+	Number      int       `json:"number"`
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"`
+	Description string    `json:"description"`
+}
+
+// printConfigHistory lists the changes recorded in the history of the config-file, numbered from the latest one for
+// `config undo`
+func (a *Application) printConfigHistory(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("config history", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	asJson := flags.Bool("json", false, "output as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return errors.New("usage: linkquisition config history [--json]")
+	}
+
+	history, err := a.SettingsService.GetSettingsHistory()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]configHistoryEntry, 0, len(history))
+	for i := range history {
+		entries = append(entries, configHistoryEntry{
+			Number:      i + 1,
+			Time:        history[i].Time,
+			Kind:        history[i].Kind,
+			Description: history[i].Description,
+		})
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "no changes recorded")
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%3d  %s  %-12s  %s\n", entry.Number, entry.Time.Local().Format(time.DateTime), entry.Kind, entry.Description)
+	}
+
+	return nil
+}
+
+// undoConfigChanges restores the config-file as it was before the given number of the latest changes, by default the
+// latest one only
+func (a *Application) undoConfigChanges(w io.Writer, args []string) error {
+	usage := errors.New("usage: linkquisition config undo [N]")
+
+	if len(args) > 1 {
+		return usage
+	}
+
+	count := 1
+	if len(args) == 1 {
+		var err error
+		if count, err = strconv.Atoi(args[0]); err != nil || count < 1 {
+			return usage
+		}
+	}
+
+	undone, err := a.SettingsService.UndoSettingsChanges(count)
+	if err != nil {
+		return err
+	}
+
+	for i := range undone {
+		fmt.Fprintf(w, "undone: %s (%s)\n", undone[i].Description, undone[i].Time.Local().Format(time.DateTime))
+	}
+
+	return nil
+}
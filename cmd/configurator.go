@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/diamondburned/gotk4/pkg/gdk/v4"
 	"github.com/diamondburned/gotk4/pkg/gdkpixbuf/v2"
@@ -37,6 +41,10 @@ func (c *Configurator) Run() {
 
 	notebook := gtk.NewNotebook()
 	notebook.AppendPage(c.getGeneralTab(), gtk.NewLabel("General"))
+	if policyTab := c.getPolicyTab(); policyTab != nil {
+		notebook.AppendPage(policyTab, gtk.NewLabel("Policy"))
+	}
+	notebook.AppendPage(c.getDiagnosticsTab(), gtk.NewLabel("Diagnostics"))
 	notebook.AppendPage(c.getAboutTab(), gtk.NewLabel("About"))
 	win.SetChild(notebook)
 
@@ -84,7 +92,15 @@ func (c *Configurator) getGeneralTab() gtk.Widgetter {
 	vbox.Append(makeDefaultButton)
 
 	// SCAN BROWSERS -BUTTON
-	setupScanBrowsersButton := func(button *gtk.Button, alreadyScanned bool) {
+	setupScanBrowsersButton := func(button *gtk.Button, alreadyScanned bool, configErr error) {
+		// a config-file that can't be parsed is left for the user to fix rather than scanned over
+		var parseErr *linkquisition.SettingsParseError
+		if errors.As(configErr, &parseErr) {
+			button.SetLabel("Fix the configuration file to scan browsers")
+			button.SetSensitive(false)
+			return
+		}
+
 		if alreadyScanned {
 			button.SetLabel("Re-scan browsers")
 		} else {
@@ -104,16 +120,24 @@ func (c *Configurator) getGeneralTab() gtk.Widgetter {
 			scanBrowsersButton.SetSensitive(true)
 			fmt.Printf("error scanning browsers: %v", err)
 		} else {
-			isConfigured, _ := c.settingsService.IsConfigured()
-			setupScanBrowsersButton(scanBrowsersButton, isConfigured)
+			isConfigured, configErr := c.settingsService.IsConfigured()
+			setupScanBrowsersButton(scanBrowsersButton, isConfigured, configErr)
 		}
 	})
 
 	// TODO show a spinner while scanning
 	// TODO show a message when scanning is done
-	// TODO show a message (instead of the button) if configuration is invalid (corrupted file etc)
-	isConfigured, _ := c.settingsService.IsConfigured()
-	setupScanBrowsersButton(scanBrowsersButton, isConfigured)
+	isConfigured, configErr := c.settingsService.IsConfigured()
+	setupScanBrowsersButton(scanBrowsersButton, isConfigured, configErr)
+
+	var parseErr *linkquisition.SettingsParseError
+	if errors.As(configErr, &parseErr) {
+		errorLabel := gtk.NewLabel(
+			"The configuration file can't be used and is ignored until fixed\n(see the Diagnostics -tab):\n\n" + parseErr.Error(),
+		)
+		errorLabel.SetWrap(true)
+		vbox.Append(errorLabel)
+	}
 
 	descLabel := gtk.NewLabel(
 		"The browsers should be scanned and stored in a configuration file for\n" +
@@ -126,6 +150,197 @@ func (c *Configurator) getGeneralTab() gtk.Widgetter {
 	vbox.Append(descLabel)
 	vbox.Append(scanBrowsersButton)
 
+	if modeSelector := c.getModeSelector(); modeSelector != nil {
+		vbox.Append(modeSelector)
+	}
+
+	vbox.Append(c.getUndoRememberButton())
+
+	return vbox
+}
+
+// getUndoRememberButton returns the button for removing the rule of the latest choice remembered in the picker, leaving
+// any changes made since in place
+func (c *Configurator) getUndoRememberButton() gtk.Widgetter {
+	button := gtk.NewButton()
+
+	latestRemembered := func() *linkquisition.SettingsHistoryEntry {
+		history, err := c.settingsService.GetSettingsHistory()
+		if err != nil {
+			return nil
+		}
+		settings, err := c.settingsService.ReadSettings()
+		if err != nil {
+			return nil
+		}
+		return linkquisition.FindUndoableRemember(history, settings)
+	}
+
+	setupUndoButton := func() {
+		if latest := latestRemembered(); latest != nil {
+			button.SetLabel("Undo last remembered choice")
+			button.SetTooltipText(latest.Description)
+			button.SetSensitive(true)
+		} else {
+			button.SetLabel("No remembered choice to undo")
+			button.SetTooltipText("")
+			button.SetSensitive(false)
+		}
+	}
+
+	button.ConnectClicked(func() {
+		// the config-file may have been changed in the meantime, in which case there's a different choice to undo
+		if latest := latestRemembered(); latest != nil {
+			change := linkquisition.SettingsChange{
+				Kind:        linkquisition.SettingsChangeConfigurator,
+				Description: "undid: " + latest.Description,
+			}
+			err := c.settingsService.UpdateSettings(change, func(settings *linkquisition.Settings) error {
+				settings.RemoveMatchFromBrowser(latest.Browser, latest.Rule)
+				return nil
+			})
+			if err != nil {
+				fmt.Printf("error undoing the remembered choice: %v\n", err)
+			}
+		}
+		setupUndoButton()
+	})
+
+	setupUndoButton()
+
+	return button
+}
+
+// getModeSelector returns the row for switching the active mode, or nil if there are no modes to switch between
+func (c *Configurator) getModeSelector() gtk.Widgetter {
+	settings, err := c.settingsService.ReadSettings()
+	if err != nil || len(settings.Modes) == 0 {
+		return nil
+	}
+
+	names := []string{"(none)"}
+	selected := 0
+	for i := range settings.Modes {
+		names = append(names, settings.Modes[i].Name)
+		if settings.Modes[i].Name == settings.ActiveMode {
+			selected = i + 1
+		}
+	}
+
+	modeChoice := gtk.NewDropDownFromStrings(names)
+	modeChoice.SetSelected(uint(selected))
+
+	modeChoice.NotifyProperty("selected", func() {
+		mode := ""
+		if index := int(modeChoice.Selected()); index > 0 && index < len(names) {
+			mode = names[index]
+		}
+
+		// the mode is switched on the current settings in order not to overwrite changes made elsewhere in the meantime
+		change := linkquisition.SettingsChange{Kind: linkquisition.SettingsChangeConfigurator, Description: describeModeSwitch(mode)}
+		updateErr := c.settingsService.UpdateSettings(change, func(current *linkquisition.Settings) error {
+			return current.SetActiveMode(mode)
+		})
+		if updateErr != nil {
+			fmt.Printf("error switching the mode: %v\n", updateErr)
+		}
+	})
+
+	row := gtk.NewBox(gtk.OrientationHorizontal, spacingSmall)
+	row.Append(gtk.NewLabel("Active mode:"))
+	row.Append(modeChoice)
+
+	return row
+}
+
+// getPolicyTab returns a read-only listing of the rules and the plugins locked by a policy, or nil if there are none
+func (c *Configurator) getPolicyTab() gtk.Widgetter {
+	settings := c.settingsService.GetSettings()
+
+	var lines []string
+	for _, rule := range settings.GetLockedRules() {
+		browser := rule.Browser
+		if browser == "" && rule.Role != "" {
+			browser = "role " + rule.Role
+		}
+		owner := describeRuleOwner(true, "", rule.Action, browser, rule.Origin)
+		lines = append(lines, fmt.Sprintf("%s %q: %s", rule.Type, rule.Value, owner))
+	}
+	for i := range settings.Plugins {
+		if settings.Plugins[i].Locked {
+			lines = append(lines, fmt.Sprintf("plugin %s from %s", settings.Plugins[i].Path, filepath.Base(settings.Plugins[i].Origin)))
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	vbox := gtk.NewBox(gtk.OrientationVertical, spacingMedium)
+
+	descLabel := gtk.NewLabel("The following are managed by your administrator and can't be changed:")
+	descLabel.SetXAlign(0)
+	vbox.Append(descLabel)
+
+	rulesLabel := gtk.NewLabel(strings.Join(lines, "\n"))
+	rulesLabel.SetXAlign(0)
+	rulesLabel.SetSelectable(true)
+	rulesLabel.SetWrap(true)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetChild(rulesLabel)
+	vbox.Append(scrolled)
+
+	return vbox
+}
+
+func (c *Configurator) getDiagnosticsTab() gtk.Widgetter {
+	vbox := gtk.NewBox(gtk.OrientationVertical, spacingMedium)
+
+	resultsLabel := gtk.NewLabel("")
+	resultsLabel.SetXAlign(0)
+	resultsLabel.SetSelectable(true)
+	resultsLabel.SetWrap(true)
+
+	scrolled := gtk.NewScrolledWindow()
+	scrolled.SetVExpand(true)
+	scrolled.SetChild(resultsLabel)
+
+	check := func() {
+		path := c.settingsService.GetConfigFilePath()
+
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			resultsLabel.SetText("Not configured yet: scan the browsers to create the config-file.")
+			return
+		}
+
+		diagnostics, err := lintConfigFile(path, c.settingsService.GetPluginFolderPaths(), false)
+		if err != nil {
+			resultsLabel.SetText(err.Error())
+			return
+		}
+
+		if len(diagnostics) == 0 {
+			resultsLabel.SetText(fmt.Sprintf("No problems found in %s", path))
+			return
+		}
+
+		lines := []string{fmt.Sprintf("Problems found in %s:", path), ""}
+		for _, diagnostic := range diagnostics {
+			lines = append(lines, diagnostic.String())
+		}
+		resultsLabel.SetText(strings.Join(lines, "\n"))
+	}
+
+	recheckButton := gtk.NewButtonWithLabel("Re-check")
+	recheckButton.ConnectClicked(check)
+
+	check()
+
+	vbox.Append(scrolled)
+	vbox.Append(recheckButton)
+
 	return vbox
 }
 
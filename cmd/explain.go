@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"al.essio.dev/pkg/shellescape"
+
+	"github.com/strobotti/linkquisition"
+)
+
+// explanation describes how a URL would be handled, without actually opening it
+type explanation struct {
+	Url        string                   `json:"url"`
+	FinalUrl   string                   `json:"finalUrl"`
+	Plugins    []pluginStep             `json:"plugins"`
+	Rules      []ruleEvaluation         `json:"rules"`
+	Match      *explainedMatch          `json:"match"`
+	Command    []string                 `json:"command,omitempty"`
+	Picker     []string                 `json:"picker,omitempty"`
+	SourceApp  *linkquisition.SourceApp `json:"sourceApp,omitempty"`
+	Configured bool                     `json:"configured"`
+
+	// ConfigError tells why the config-file can't be used, in which case the rules are left out
+	ConfigError string `json:"configError,omitempty"`
+}
+
+type pluginStep struct {
+	Plugin string `json:"plugin"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type ruleEvaluation struct {
+	Action    string                     `json:"action"`
+	TopLevel  bool                       `json:"topLevel,omitempty"`
+	Mode      string                     `json:"mode,omitempty"`
+	Browser   string                     `json:"browser"`
+	RuleIndex int                        `json:"ruleIndex"`
+	Rule      linkquisition.BrowserMatch `json:"rule"`
+	Origin    string                     `json:"origin,omitempty"`
+	Matched   bool                       `json:"matched"`
+	Error     string                     `json:"error,omitempty"`
+}
+
+type explainedMatch struct {
+	Url       string                     `json:"url"`
+	Action    string                     `json:"action"`
+	TopLevel  bool                       `json:"topLevel,omitempty"`
+	Mode      string                     `json:"mode,omitempty"`
+	Browser   string                     `json:"browser"`
+	RuleIndex int                        `json:"ruleIndex"`
+	Rule      linkquisition.BrowserMatch `json:"rule"`
+	Origin    string                     `json:"origin,omitempty"`
+}
+
+// Explain runs the given URL through the plugins and the browser-rules and reports the outcome of each step, along
+// with the command that would be run to open the URL
+func (a *Application) Explain(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	asJson := flags.Bool("json", false, "output as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: linkquisition explain [--json] <url>")
+	}
+
+	e := a.explain(flags.Arg(0))
+
+	if *asJson {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(e)
+	}
+
+	printExplanation(w, e)
+
+	return nil
+}
+
+func (a *Application) explain(urlToOpen string) *explanation {
+	e := &explanation{Url: urlToOpen, Plugins: []pluginStep{}, Rules: []ruleEvaluation{}}
+
+	for _, plug := range a.plugins {
+		step := pluginStep{Plugin: plug.Path, Before: urlToOpen}
+		urlToOpen = plug.ModifyUrl(urlToOpen)
+		step.After = urlToOpen
+		e.Plugins = append(e.Plugins, step)
+	}
+	e.FinalUrl = urlToOpen
+
+	env := a.getMatchEnvironment()
+	e.SourceApp = env.SourceApp
+
+	var configErr error
+	if e.Configured, configErr = a.SettingsService.IsConfigured(); configErr != nil {
+		e.ConfigError = configErr.Error()
+	}
+
+	settings := a.SettingsService.GetSettings()
+	settings.Environment = env
+
+	matcher, _ := settings.GetMatcher()
+
+	for _, evaluation := range matcher.Explain(urlToOpen) {
+		rule := ruleEvaluation{
+			Action:    evaluation.Action,
+			TopLevel:  evaluation.BrowserIndex < 0,
+			Mode:      evaluation.Mode,
+			Browser:   evaluation.Browser.Name,
+			RuleIndex: evaluation.RuleIndex,
+			Rule:      evaluation.Rule,
+			Origin:    evaluation.Rule.Origin,
+			Matched:   evaluation.Matched,
+		}
+		if evaluation.Err != nil {
+			rule.Error = evaluation.Err.Error()
+		}
+		e.Rules = append(e.Rules, rule)
+	}
+
+	result, err := matcher.Match(urlToOpen)
+	if err == nil {
+		e.Match = &explainedMatch{
+			Url:       result.Url,
+			Action:    result.Action,
+			TopLevel:  result.TopLevelRule != nil,
+			Mode:      result.Mode,
+			Browser:   result.Browser.Name,
+			RuleIndex: result.RuleIndex,
+			Rule:      result.Rule,
+			Origin:    result.Rule.Origin,
+		}
+		if result.Action == linkquisition.RuleActionOpen {
+			e.Command = a.BrowserService.GetLaunchCommand(result.Url, &result.Browser)
+		}
+	}
+
+	if err != nil || result.Action == linkquisition.RuleActionAsk {
+		browsers := settings.GetSelectableBrowsers()
+		if !e.Configured {
+			browsers, _ = a.BrowserService.GetAvailableBrowsers()
+		}
+		for _, browser := range browsers {
+			e.Picker = append(e.Picker, browser.Name)
+		}
+	}
+
+	return e
+}
+
+func printExplanation(w io.Writer, e *explanation) {
+	fmt.Fprintf(w, "URL: %s\n", e.Url)
+
+	if e.SourceApp != nil && len(e.SourceApp.Processes) > 0 {
+		fmt.Fprintf(w, "Source app: %s %v\n", e.SourceApp.DesktopFile, e.SourceApp.Processes)
+	}
+
+	fmt.Fprintln(w, "\nPlugins:")
+	if len(e.Plugins) == 0 {
+		fmt.Fprintln(w, "  (none enabled)")
+	}
+	for _, step := range e.Plugins {
+		if step.Before == step.After {
+			fmt.Fprintf(w, "  %s: unchanged\n", step.Plugin)
+		} else {
+			fmt.Fprintf(w, "  %s: %s\n    => %s\n", step.Plugin, step.Before, step.After)
+		}
+	}
+
+	fmt.Fprintln(w, "\nRules:")
+	switch {
+	case e.ConfigError != "":
+		fmt.Fprintf(w, "  (the config-file is ignored: %s)\n", e.ConfigError)
+	case !e.Configured:
+		fmt.Fprintln(w, "  (not configured)")
+	}
+	for _, rule := range e.Rules {
+		outcome := "no match"
+		switch {
+		case rule.Error != "":
+			outcome = "INVALID: " + rule.Error
+		case rule.Matched:
+			outcome = "MATCH"
+		}
+		owner := describeRuleOwner(rule.TopLevel, rule.Mode, rule.Action, rule.Browser, rule.Origin)
+		fmt.Fprintf(w, "  %s #%d %s %q: %s\n", owner, rule.RuleIndex, rule.Rule.Type, rule.Rule.Value, outcome)
+	}
+
+	fmt.Fprintln(w, "\nResult:")
+	if e.Match == nil {
+		fmt.Fprintf(w, "  no rule matched %s; the picker would be shown with: %v\n", e.FinalUrl, e.Picker)
+		return
+	}
+
+	owner := describeRuleOwner(e.Match.TopLevel, e.Match.Mode, e.Match.Action, e.Match.Browser, e.Match.Origin)
+
+	if e.Match.Url != e.FinalUrl && e.Match.Action != linkquisition.RuleActionAsk && e.Match.Action != linkquisition.RuleActionBlock {
+		fmt.Fprintf(w, "  the rule rewrites %s\n    => %s\n", e.FinalUrl, e.Match.Url)
+	}
+
+	switch e.Match.Action {
+	case linkquisition.RuleActionBlock:
+		fmt.Fprintf(w, "  %s would be blocked (%s #%d)\n", e.FinalUrl, owner, e.Match.RuleIndex)
+	case linkquisition.RuleActionAsk:
+		fmt.Fprintf(w, "  the picker would be shown for %s (%s #%d) with: %v\n", e.FinalUrl, owner, e.Match.RuleIndex, e.Picker)
+	case linkquisition.RuleActionCopy:
+		fmt.Fprintf(w, "  %s would be copied to the clipboard (%s #%d)\n", e.Match.Url, owner, e.Match.RuleIndex)
+	case linkquisition.RuleActionSystemDefault:
+		fmt.Fprintf(w, "  %s would be opened with the system default browser (%s #%d)\n", e.Match.Url, owner, e.Match.RuleIndex)
+	default:
+		fmt.Fprintf(w, "  %s would be opened with %s (%s #%d)\n", e.Match.Url, e.Match.Browser, owner, e.Match.RuleIndex)
+		fmt.Fprintf(w, "  command: %s\n", shellescape.QuoteCommand(e.Command))
+	}
+}
+
+// describeRuleOwner names the browser a rule belongs to, or the mode and the action of a top-level rule, along with
+// the drop-in the rule comes from
+func describeRuleOwner(topLevel bool, mode, action, browser, origin string) string {
+	if origin != "" {
+		return describeRuleOwner(topLevel, mode, action, browser, "") + " from " + filepath.Base(origin)
+	}
+
+	if !topLevel {
+		return browser
+	}
+
+	owner := "rules"
+	if mode != "" {
+		owner = "mode " + mode + " rules"
+	}
+
+	if action == linkquisition.RuleActionOpen {
+		return owner + " (open with " + browser + ")"
+	}
+
+	return owner + " (" + action + ")"
+}
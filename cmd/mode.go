@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/strobotti/linkquisition"
+)
+
+// Mode lists the modes, marking the active one, or switches the active mode
+func (a *Application) Mode(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("mode", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	off := flags.Bool("off", false, "deactivate the active mode, leaving only the global rules in effect")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 || (*off && flags.NArg() > 0) {
+		return errors.New("usage: linkquisition mode [--off | <name>]")
+	}
+
+	settings, err := a.SettingsService.ReadSettings()
+	if err != nil {
+		return err
+	}
+
+	if !*off && flags.NArg() == 0 {
+		if len(settings.Modes) == 0 {
+			fmt.Fprintln(w, "no modes configured")
+		}
+		for i := range settings.Modes {
+			marker := " "
+			if settings.Modes[i].Name == settings.ActiveMode {
+				marker = "*"
+			}
+			fmt.Fprintf(w, "%s %s (%d rules)\n", marker, settings.Modes[i].Name, len(settings.Modes[i].Rules))
+		}
+		return nil
+	}
+
+	change := linkquisition.SettingsChange{Kind: linkquisition.SettingsChangeCommand, Description: describeModeSwitch(flags.Arg(0))}
+	err = a.SettingsService.UpdateSettings(change, func(current *linkquisition.Settings) error {
+		settings = current
+		return current.SetActiveMode(flags.Arg(0))
+	})
+	if err != nil {
+		return err
+	}
+
+	if settings.ActiveMode == "" {
+		fmt.Fprintln(w, "no mode is active")
+	} else {
+		fmt.Fprintf(w, "switched to mode %s\n", settings.ActiveMode)
+	}
+
+	return nil
+}
+
+// describeModeSwitch describes switching to the given mode for the history of the config-file
+func describeModeSwitch(mode string) string {
+	if mode == "" {
+		return "deactivated the mode"
+	}
+
+	return "switched to mode " + mode
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/strobotti/linkquisition"
+)
+
+const defaultUnusedDays = 90
+const defaultHotRules = 10
+
+// Rules runs the given `rules` subcommand
+func (a *Application) Rules(w io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: linkquisition rules stats [--json] [--top N] [--unused-days N] [--prune]")
+	}
+
+	switch args[0] {
+	case "stats":
+		return a.ruleStats(w, args[1:])
+	default:
+		return fmt.Errorf("unknown rules subcommand `%s`", args[0])
+	}
+}
+
+type ruleStatsOutput struct {
+	UnusedDays int                            `json:"unusedDays"`
+	Report     *linkquisition.RuleStatsReport `json:"report"`
+	Pruned     int                            `json:"pruned"`
+}
+
+// ruleStats reports the most used rules, the rules that never matched and the rules unused for the given number of
+// days, optionally removing the unused rules from the config-file
+func (a *Application) ruleStats(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("rules stats", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	asJson := flags.Bool("json", false, "output as JSON")
+	top := flags.Int("top", defaultHotRules, "the number of most used rules to list")
+	unusedDays := flags.Int("unused-days", defaultUnusedDays, "the number of days after which a rule is considered unused")
+	prune := flags.Bool("prune", false, "remove the unused rules from the config-file")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 || *top < 0 {
+		return errors.New("usage: linkquisition rules stats [--json] [--top N] [--unused-days N] [--prune]")
+	}
+
+	settings, err := a.SettingsService.ReadSettings()
+	if err != nil {
+		return err
+	}
+
+	var out ruleStatsOutput
+
+	// the stats are written even without pruning to remember when the new rules were first seen
+	err = a.RuleStatsService.UpdateRuleStats(func(stats *linkquisition.RuleStats) error {
+		now := time.Now()
+		stats.Sync(settings, now)
+
+		out = ruleStatsOutput{
+			UnusedDays: *unusedDays,
+			Report:     stats.Report(now.AddDate(0, 0, -*unusedDays)),
+		}
+		out.Report.Hot = out.Report.Hot[:min(*top, len(out.Report.Hot))]
+
+		if !*prune || len(out.Report.Unused) == 0 {
+			return nil
+		}
+
+		change := linkquisition.SettingsChange{
+			Kind:        linkquisition.SettingsChangeCommand,
+			Description: fmt.Sprintf("pruned the rules unused for %d days", *unusedDays),
+		}
+		errUpdate := a.SettingsService.UpdateSettings(change, func(current *linkquisition.Settings) error {
+			settings = current
+			out.Pruned = current.RemoveRules(out.Report.Unused)
+			return nil
+		})
+		if errUpdate != nil {
+			return errUpdate
+		}
+		stats.Sync(settings, now)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJson {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(out)
+	}
+
+	printRuleStats(w, &out)
+
+	return nil
+}
+
+func printRuleStats(w io.Writer, out *ruleStatsOutput) {
+	fmt.Fprintln(w, "Most used rules:")
+	if len(out.Report.Hot) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	for _, stat := range out.Report.Hot {
+		fmt.Fprintf(
+			w, "  %6d  %s %s %q (last %s)\n",
+			stat.Hits, stat.Browser, stat.Rule.Type, stat.Rule.Value, stat.LastHit.Format(time.DateOnly),
+		)
+	}
+
+	fmt.Fprintln(w, "\nRules that never matched:")
+	if len(out.Report.NeverMatched) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	for _, stat := range out.Report.NeverMatched {
+		fmt.Fprintf(
+			w, "  %s %s %q (since %s)\n",
+			stat.Browser, stat.Rule.Type, stat.Rule.Value, stat.FirstSeen.Format(time.DateOnly),
+		)
+	}
+
+	fmt.Fprintf(w, "\nRules unused for %d days:\n", out.UnusedDays)
+	if len(out.Report.Unused) == 0 {
+		fmt.Fprintln(w, "  (none)")
+	}
+	for _, stat := range out.Report.Unused {
+		fmt.Fprintf(
+			w, "  %s %s %q (last used %s)\n",
+			stat.Browser, stat.Rule.Type, stat.Rule.Value, stat.LastUsed().Format(time.DateOnly),
+		)
+	}
+
+	if out.Pruned > 0 {
+		fmt.Fprintf(w, "\nRemoved %d unused rules from the config-file\n", out.Pruned)
+	}
+}
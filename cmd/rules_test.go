@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplication_Rules_Usage(t *testing.T) {
+	a := &Application{}
+
+	for _, tt := range []struct {
+		name string
+		args []string
+	}{
+		{name: "no subcommand", args: []string{}},
+		{name: "unknown subcommand", args: []string{"list"}},
+		{name: "extra arguments", args: []string{"stats", "extra"}},
+		{name: "a negative number of the most used rules", args: []string{"stats", "--top", "-1"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, a.Rules(io.Discard, tt.args))
+		})
+	}
+}
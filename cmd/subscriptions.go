@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Subscriptions lists the subscriptions along with the number of rules merged from each, or refreshes them
+func (a *Application) Subscriptions(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("subscriptions", flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 || (flags.NArg() == 1 && flags.Arg(0) != "refresh") {
+		return errors.New("usage: linkquisition subscriptions [refresh]")
+	}
+
+	var errRefresh error
+	if flags.Arg(0) == "refresh" {
+		// the failures are reported after the list, which shows what is in effect regardless
+		errRefresh = a.SettingsService.RefreshSubscriptions(true)
+	}
+
+	settings, err := a.SettingsService.ReadSettings()
+	if err != nil {
+		return err
+	}
+
+	if len(settings.Subscriptions) == 0 {
+		fmt.Fprintln(w, "no subscriptions configured")
+	}
+	for i := range settings.Subscriptions {
+		subscription := &settings.Subscriptions[i]
+		if subscription.IsDisabled {
+			fmt.Fprintf(w, "%s (disabled)\n", subscription.Source)
+			continue
+		}
+		fmt.Fprintf(w, "%s (%d rules)\n", subscription.Source, len(settings.GetSubscriptionRules(subscription.Source)))
+	}
+
+	return errRefresh
+}
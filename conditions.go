@@ -0,0 +1,106 @@
+package linkquisition
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var ErrEmptyPathPrefix = errors.New("empty path prefix")
+var ErrEmptyQuery = errors.New("empty query")
+
+// pathPrefix is a compiled `pathPrefix` -rule such as `github.com/our-org` or `/our-org`
+//
+// The optional host-part is matched case-insensitively against the host of the URL, just like a `site` -rule. The
+// path-part matches on segment boundaries: `/our-org` matches `/our-org` and `/our-org/repo` but not `/our-orgs`. A
+// trailing `/*`, as in `github.com/our-org/*`, is redundant and ignored.
+type pathPrefix struct {
+	host   string
+	prefix string
+}
+
+func compilePathPrefix(value string) (*pathPrefix, error) {
+	host, path, _ := strings.Cut(strings.TrimSuffix(value, "/*"), "/")
+	path = "/" + path
+
+	if host == "" && path == "/" {
+		return nil, ErrEmptyPathPrefix
+	}
+
+	if host != "" {
+		host = normalizeSite(host)
+	}
+
+	return &pathPrefix{host: host, prefix: path}, nil
+}
+
+func (p *pathPrefix) matches(u *url.URL) bool {
+	if p.host != "" && !matchesSite(p.host, u) {
+		return false
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	if !strings.HasPrefix(path, p.prefix) {
+		return false
+	}
+
+	return strings.HasSuffix(p.prefix, "/") || len(path) == len(p.prefix) || path[len(p.prefix)] == '/'
+}
+
+// queryMatch is a compiled `query` -rule such as `tenant=acme` or `login.microsoftonline.com?tenant=acme`
+//
+// Every parameter in the rule has to be present in the URL; a parameter given without a value only has to be present
+// and a parameter with a value has to have that exact value. The optional host-part is matched like a `site` -rule.
+type queryMatch struct {
+	host   string
+	params url.Values
+}
+
+func compileQuery(value string) (*queryMatch, error) {
+	host, query, found := strings.Cut(value, "?")
+	if !found {
+		host, query = "", value
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(params) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	if host != "" {
+		host = normalizeSite(host)
+	}
+
+	return &queryMatch{host: host, params: params}, nil
+}
+
+func (q *queryMatch) matches(u *url.URL) bool {
+	if q.host != "" && !matchesSite(q.host, u) {
+		return false
+	}
+
+	query := u.Query()
+
+	for key, values := range q.params {
+		if !query.Has(key) {
+			return false
+		}
+
+		for _, value := range values {
+			if value != "" && !slices.Contains(query[key], value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -108,17 +108,23 @@ func (b *BrowserService) OpenUrlWithDefaultBrowser(url string) error {
 	return nil
 }
 
-func (b *BrowserService) OpenUrlWithBrowser(u string, browser *linkquisition.Browser) error {
+func (b *BrowserService) GetLaunchCommand(u string, browser *linkquisition.Browser) []string {
 	u = shellescape.Quote(u)
 
 	command := browser.Command
 	command = strings.ReplaceAll(command, "%u", u)
 	command = strings.ReplaceAll(command, "%U", u)
 
+	return []string{"sh", "-c", command}
+}
+
+func (b *BrowserService) OpenUrlWithBrowser(u string, browser *linkquisition.Browser) error {
+	args := b.GetLaunchCommand(u, browser)
+
 	// now just execute the damn command
-	cmd := exec.CommandContext(context.Background(), "sh", "-c", command)
+	cmd := exec.CommandContext(context.Background(), args[0], args[1:]...) //nolint:gosec
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to open URL `%s` with browser `%s`: %v", u, browser.Name, err)
+		return fmt.Errorf("failed to open URL `%s` with browser `%s`: %v", shellescape.Quote(u), browser.Name, err)
 	}
 
 	// Reap the child in the background; we don't need to wait for the browser to exit.
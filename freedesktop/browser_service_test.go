@@ -0,0 +1,47 @@
+package freedesktop_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/strobotti/linkquisition"
+	. "github.com/strobotti/linkquisition/freedesktop"
+)
+
+func TestBrowserService_GetLaunchCommand(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		command  string
+		url      string
+		expected []string
+	}{
+		{
+			name:     "lowercase placeholder is replaced with the quoted URL",
+			command:  "firefox %u",
+			url:      "https://www.example.com/?a=1&b=2",
+			expected: []string{"sh", "-c", "firefox 'https://www.example.com/?a=1&b=2'"},
+		},
+		{
+			name:     "uppercase placeholder is replaced with the quoted URL",
+			command:  "/usr/bin/chromium --profile-directory=Default %U",
+			url:      "https://www.example.com/",
+			expected: []string{"sh", "-c", "/usr/bin/chromium --profile-directory=Default https://www.example.com/"},
+		},
+		{
+			name:     "quotes in the URL are escaped",
+			command:  "firefox %u",
+			url:      "https://www.example.com/'; rm -rf ~",
+			expected: []string{"sh", "-c", `firefox 'https://www.example.com/'"'"'; rm -rf ~'`},
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				service := &BrowserService{}
+				browser := &linkquisition.Browser{Name: "Browser", Command: tt.command}
+
+				assert.Equal(t, tt.expected, service.GetLaunchCommand(tt.url, browser))
+			},
+		)
+	}
+}
@@ -0,0 +1,83 @@
+package freedesktop
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// writeFileAtomically writes the data to a temporary file next to the given one and renames it over the file once the
+// data is safely on the disk, so that the file is never left truncated or half-written even if the process crashes. A
+// symlink is followed and the file it points to is replaced instead, so that e.g. a config-file kept in a dotfile
+// repository stays linked.
+func writeFileAtomically(path string, data []byte, perm os.FileMode) (err error) {
+	if target, errEval := filepath.EvalSymlinks(path); errEval == nil {
+		path = target
+	} else if !errors.Is(errEval, os.ErrNotExist) {
+		return errEval
+	}
+
+	dir := filepath.Dir(path)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// the rename itself is only durable once the directory is synced as well
+	if d, errOpen := os.Open(dir); errOpen == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	return nil
+}
+
+// lockFile takes an exclusive advisory lock on the given file, creating it if needed, and blocks until the lock is
+// acquired. The lock is held until the returned function is called, or until the process exits.
+func lockFile(path string, perm os.FileMode) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, perm)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the lock-file `%s`: %v", path, err)
+	}
+
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("unable to lock `%s`: %v", path, err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
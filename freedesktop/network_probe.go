@@ -0,0 +1,97 @@
+package freedesktop
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/strobotti/linkquisition"
+)
+
+const defaultResolvConfPath = "/etc/resolv.conf"
+
+var _ linkquisition.NetworkProbe = (*NetworkProbe)(nil)
+
+// NetworkProbe inspects the network interfaces of the system and the DNS search domains in resolv.conf
+type NetworkProbe struct {
+	// ResolvConfPath is the path to the resolver configuration; defaults to /etc/resolv.conf
+	ResolvConfPath string
+}
+
+func (p *NetworkProbe) Interfaces() ([]linkquisition.NetworkInterface, error) {
+	systemInterfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the network interfaces: %v", err)
+	}
+
+	var interfaces []linkquisition.NetworkInterface
+
+	for i := range systemInterfaces {
+		if systemInterfaces[i].Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		networkInterface := linkquisition.NetworkInterface{Name: systemInterfaces[i].Name}
+
+		addresses, addrErr := systemInterfaces[i].Addrs()
+		if addrErr != nil {
+			return nil, fmt.Errorf("failed to list the addresses of `%s`: %v", systemInterfaces[i].Name, addrErr)
+		}
+
+		for _, address := range addresses {
+			if prefix, parseErr := netip.ParsePrefix(address.String()); parseErr == nil {
+				networkInterface.Addresses = append(networkInterface.Addresses, prefix)
+			}
+		}
+
+		interfaces = append(interfaces, networkInterface)
+	}
+
+	return interfaces, nil
+}
+
+func (p *NetworkProbe) SearchDomains() ([]string, error) {
+	path := p.ResolvConfPath
+	if path == "" {
+		path = defaultResolvConfPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read `%s`: %v", path, err)
+	}
+
+	return parseSearchDomains(data), nil
+}
+
+// parseSearchDomains returns the domains of the `search` and `domain` -directives; as with the resolver, the last
+// `search` -directive wins
+func parseSearchDomains(resolvConf []byte) []string {
+	var domain string
+	var search []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(resolvConf))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 { //nolint:mnd
+			continue
+		}
+
+		switch fields[0] {
+		case "search":
+			search = fields[1:]
+		case "domain":
+			domain = fields[1]
+		}
+	}
+
+	if search == nil && domain != "" {
+		return []string{domain}
+	}
+
+	return search
+}
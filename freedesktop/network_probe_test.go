@@ -0,0 +1,60 @@
+package freedesktop_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition/freedesktop"
+)
+
+func TestNetworkProbe_SearchDomains(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		resolvConf string
+		expected   []string
+	}{
+		{
+			name:       "search domains are returned",
+			resolvConf: "# generated\nnameserver 127.0.0.53\nsearch corp.example.com example.com\noptions edns0\n",
+			expected:   []string{"corp.example.com", "example.com"},
+		},
+		{
+			name:       "the last search directive wins",
+			resolvConf: "search home.arpa\nsearch corp.example.com\n",
+			expected:   []string{"corp.example.com"},
+		},
+		{
+			name:       "domain directive is used without search directives",
+			resolvConf: "domain corp.example.com\nnameserver 10.0.0.1\n",
+			expected:   []string{"corp.example.com"},
+		},
+		{
+			name:       "no search domains",
+			resolvConf: "nameserver 127.0.0.53\n",
+			expected:   nil,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), "resolv.conf")
+				require.NoError(t, os.WriteFile(path, []byte(tt.resolvConf), 0o600))
+
+				probe := &NetworkProbe{ResolvConfPath: path}
+				domains, err := probe.SearchDomains()
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, domains)
+			},
+		)
+	}
+}
+
+func TestNetworkProbe_SearchDomains_MissingFile(t *testing.T) {
+	probe := &NetworkProbe{ResolvConfPath: filepath.Join(t.TempDir(), "missing")}
+
+	_, err := probe.SearchDomains()
+	assert.Error(t, err)
+}
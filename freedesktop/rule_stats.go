@@ -0,0 +1,99 @@
+package freedesktop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/strobotti/linkquisition"
+)
+
+var stateDirPerms os.FileMode = 0o700
+var stateFilePerms os.FileMode = 0o600
+
+var _ linkquisition.RuleStatsService = (*RuleStatsService)(nil)
+
+// RuleStatsService stores the usage statistics of the browser-rules in the state folder, next to the log-file
+type RuleStatsService struct {
+	FolderPath string
+
+	// Logger is told about a rule-stats file that can't be parsed; nothing is logged without one
+	Logger *slog.Logger
+}
+
+func (s *RuleStatsService) GetRuleStatsFilePath() string {
+	return filepath.Join(s.FolderPath, "rule-stats.json")
+}
+
+// GetLockFilePath returns the path to the file locked for the duration of updating the rule-stats
+func (s *RuleStatsService) GetLockFilePath() string {
+	return filepath.Join(s.FolderPath, ".rule-stats.json.lock")
+}
+
+// ReadRuleStats reads the statistics from the state-file. The file is only ever replaced as a whole, so reading it
+// takes no lock. A file that can't be parsed is logged and read as empty statistics, which replace it on the next
+// update: the statistics aren't worth making every later run fail for.
+func (s *RuleStatsService) ReadRuleStats() (*linkquisition.RuleStats, error) {
+	data, err := os.ReadFile(s.GetRuleStatsFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return &linkquisition.RuleStats{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to open rule-stats `%s` for reading: %v", s.GetRuleStatsFilePath(), err)
+	}
+
+	stats := &linkquisition.RuleStats{}
+
+	if err := json.Unmarshal(data, stats); err != nil {
+		s.logger().Warn(
+			"unable to parse the rule-stats, starting over", "file", s.GetRuleStatsFilePath(), "error", err.Error(),
+		)
+		return &linkquisition.RuleStats{}, nil
+	}
+
+	return stats, nil
+}
+
+// UpdateRuleStats reads the statistics, applies the given update to them and writes them back, all while holding the
+// lock on the state-file so that no concurrent update gets lost. Nothing is written if the update returns an error.
+func (s *RuleStatsService) UpdateRuleStats(update func(stats *linkquisition.RuleStats) error) error {
+	if errMkdir := os.MkdirAll(s.FolderPath, stateDirPerms); errMkdir != nil {
+		return fmt.Errorf("failed to write rule-stats: %v", errMkdir)
+	}
+
+	unlock, err := lockFile(s.GetLockFilePath(), stateFilePerms)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stats, err := s.ReadRuleStats()
+	if err != nil {
+		return err
+	}
+
+	if err := update(stats); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal rule-stats: %v", err)
+	}
+
+	if errWrite := writeFileAtomically(s.GetRuleStatsFilePath(), data, stateFilePerms); errWrite != nil {
+		return fmt.Errorf("failed to write rule-stats: %v", errWrite)
+	}
+
+	return nil
+}
+
+func (s *RuleStatsService) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+
+	return s.Logger
+}
@@ -0,0 +1,73 @@
+package freedesktop_test
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strobotti/linkquisition"
+	. "github.com/strobotti/linkquisition/freedesktop"
+)
+
+func TestRuleStatsService_UpdateRuleStats_Concurrently(t *testing.T) {
+	const writers = 20
+
+	service := &RuleStatsService{FolderPath: t.TempDir()}
+	firefox := &linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}
+	rule := linkquisition.BrowserMatch{Type: linkquisition.BrowserMatchTypeSite, Value: "example.com"}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+
+	for range writers {
+		wg.Go(func() {
+			errs <- service.UpdateRuleStats(func(stats *linkquisition.RuleStats) error {
+				stats.RecordHit(firefox, rule, time.Now())
+				return nil
+			})
+		})
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	stats, err := service.ReadRuleStats()
+	require.NoError(t, err)
+	require.Len(t, stats.Rules, 1)
+	assert.Equal(t, writers, stats.Rules[0].Hits)
+}
+
+func TestRuleStatsService_ReadRuleStats_Broken(t *testing.T) {
+	var logged bytes.Buffer
+	service := &RuleStatsService{FolderPath: t.TempDir(), Logger: slog.New(slog.NewTextHandler(&logged, nil))}
+
+	require.NoError(t, os.WriteFile(service.GetRuleStatsFilePath(), []byte(`{"rules": [{"browser": "fire`), 0o600))
+
+	stats, err := service.ReadRuleStats()
+	require.NoError(t, err)
+	assert.Empty(t, stats.Rules)
+	assert.Contains(t, logged.String(), "unable to parse the rule-stats")
+
+	t.Run("the next update replaces the broken file", func(t *testing.T) {
+		require.NoError(t, service.UpdateRuleStats(func(stats *linkquisition.RuleStats) error {
+			stats.RecordHit(&linkquisition.Browser{Command: "firefox %u"}, linkquisition.BrowserMatch{Value: "example.com"}, time.Now())
+			return nil
+		}))
+
+		logged.Reset()
+		stats, err := service.ReadRuleStats()
+		require.NoError(t, err)
+		assert.Len(t, stats.Rules, 1)
+		assert.Empty(t, logged.String())
+	})
+}
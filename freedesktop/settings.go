@@ -1,12 +1,16 @@
 package freedesktop
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/strobotti/linkquisition"
 )
@@ -18,6 +22,47 @@ var _ linkquisition.SettingsService = (*SettingsService)(nil)
 
 type SettingsService struct {
 	BrowserService linkquisition.BrowserService
+
+	// PluginSchemas holds the schemas of the settings of the loaded plugins, keyed by the path of the plugin, for the
+	// schema written next to the config-file
+	PluginSchemas map[string]map[string]any
+
+	// HttpClient is used for fetching the subscriptions; defaults to http.DefaultClient
+	HttpClient *http.Client
+
+	// Logger is told about the problems that don't prevent using the settings; nothing is logged without one
+	Logger *slog.Logger
+
+	// cache holds the settings last read, which are reused for as long as none of the files they were read from change
+	cache   *cachedSettings
+	cacheMu sync.Mutex
+}
+
+// GetDropInFolderPath returns the path to the folder of the drop-in config-files, which are merged with the user's own
+func (s *SettingsService) GetDropInFolderPath() string {
+	return filepath.Join(s.GetConfigFolderPath(), "config.d")
+}
+
+// GetPolicyFilePaths returns the paths to the system-wide policy-files in the order of precedence, following
+// XDG_CONFIG_DIRS (default: /etc/xdg)
+func (s *SettingsService) GetPolicyFilePaths() []string {
+	var paths []string
+
+	configDirs, isset := os.LookupEnv("XDG_CONFIG_DIRS")
+	if !isset || configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for dir := range strings.SplitSeq(configDirs, ":") {
+		if dir != "" {
+			paths = append(paths, filepath.Join(dir, "linkquisition", "policy.json"))
+		}
+	}
+
+	return paths
+}
+
+func (s *SettingsService) GetSchemaFilePath() string {
+	return filepath.Join(s.GetConfigFolderPath(), "config.schema.json")
 }
 
 func (s *SettingsService) GetConfigFilePath() string {
@@ -80,39 +125,250 @@ func (s *SettingsService) GetPluginFolderPaths() []string {
 	return paths
 }
 
+// ReadSettings reads the config-file, migrating it to the current version in memory if needed, merges the drop-ins and
+// the subscriptions into it and applies the policies over it. Reading never writes: a config-file of an older version
+// is only replaced with the migrated one on the next write, see WriteSettings.
+//
+// The config-file is only ever replaced as a whole, so reading it takes no lock.
 func (s *SettingsService) ReadSettings() (*linkquisition.Settings, error) {
+	files := s.statSettingsFiles()
+	if settings := s.getCached(files); settings != nil {
+		return settings, nil
+	}
+
+	settings, err := s.readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mergeDropIns(settings)
+
+	subscriptionFiles := s.mergeSubscriptions(settings)
+
+	s.applyPolicies(settings)
+
+	s.setCached(settings, files, subscriptionFiles)
+
+	return settings, nil
+}
+
+// readConfigFile reads the user's own config-file, without anything merged into it, migrating it to the current
+// version in memory if needed
+func (s *SettingsService) readConfigFile() (*linkquisition.Settings, error) {
 	data, err := os.ReadFile(s.GetConfigFilePath())
 	if err != nil {
-		return nil, fmt.Errorf("unable to open config-file `%s` for reading: %v", s.GetConfigFilePath(), err)
+		return nil, fmt.Errorf("unable to open config-file `%s` for reading: %w", s.GetConfigFilePath(), err)
 	}
 
-	var settings = &linkquisition.Settings{}
+	settings, _, err := linkquisition.ParseSettings(data, s.GetConfigFilePath())
+
+	return settings, err
+}
 
-	if err := json.Unmarshal(data, settings); err != nil {
-		return nil, fmt.Errorf("unable to parse the config-file `%s`: %v", s.GetConfigFilePath(), err)
+// backupOldVersion backs up the given config-file next to it if it's of an older version, before it's replaced with
+// the settings of the current version
+func (s *SettingsService) backupOldVersion(data []byte) error {
+	if data == nil {
+		return nil
 	}
 
-	return settings, nil
+	_, fromVersion, err := linkquisition.MigrateSettings(data)
+	if err != nil || fromVersion == linkquisition.SettingsVersion {
+		return nil
+	}
+
+	return writeFileAtomically(s.GetBackupFilePath(fromVersion), data, configFilePerms)
+}
+
+// mergeDropIns merges the drop-in config-files into the settings in the lexical order of their names, so that the
+// user's own config-file takes precedence over the drop-ins and an earlier drop-in over a later one. The drop-ins are
+// migrated in memory only: they're never written to. A drop-in that can't be read or parsed is logged and left out,
+// rather than making the user's own settings unusable.
+func (s *SettingsService) mergeDropIns(settings *linkquisition.Settings) {
+	paths, err := s.getDropInFilePaths()
+	if err != nil {
+		s.logger().Warn("the drop-ins are ignored", "error", err.Error())
+		return
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			s.logger().Warn("the drop-in can't be read and is ignored", "file", path, "error", err.Error())
+			continue
+		}
+
+		dropIn, _, err := linkquisition.ParseSettings(data, path)
+		if err != nil {
+			s.logger().Warn("the drop-in can't be used and is ignored until fixed", "file", path, "error", err.Error())
+			continue
+		}
+
+		settings.MergeDropIn(dropIn, path)
+	}
+}
+
+func (s *SettingsService) getDropInFilePaths() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.GetDropInFolderPath(), "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the drop-ins: %v", err)
+	}
+
+	return paths, nil
+}
+
+// applyPolicies applies the policy-files found over the settings, the one of the most important directory first so
+// that it takes precedence over the rest. Like the drop-ins, the policies are never written to. A policy that can't be
+// read or parsed is logged as an error and left out: the user can't fix it, so their own settings remain usable along
+// with the other policies.
+func (s *SettingsService) applyPolicies(settings *linkquisition.Settings) {
+	for _, path := range s.GetPolicyFilePaths() {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			s.logger().Error("the policy can't be read and is not in effect", "file", path, "error", err.Error())
+			continue
+		}
+
+		policy, _, err := linkquisition.ParseSettings(data, path)
+		if err != nil {
+			s.logger().Error("the policy can't be used and is not in effect until fixed", "file", path, "error", err.Error())
+			continue
+		}
+
+		settings.ApplyPolicy(policy, path)
+	}
+}
+
+func (s *SettingsService) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+
+	return s.Logger
+}
+
+// GetBackupFilePath returns the path to the backup of the config-file of the given version, taken before migrating it
+func (s *SettingsService) GetBackupFilePath(version int) string {
+	return fmt.Sprintf("%s.v%d.bak", s.GetConfigFilePath(), version)
+}
+
+// GetLockFilePath returns the path to the file locked for the duration of updating the config-file
+func (s *SettingsService) GetLockFilePath() string {
+	return filepath.Join(s.GetConfigFolderPath(), ".config.json.lock")
+}
+
+// lock serializes the access to the config-file, both within the process and between the processes
+func (s *SettingsService) lock() (unlock func(), err error) {
+	if errMkdir := os.MkdirAll(s.GetConfigFolderPath(), configDirPerms); errMkdir != nil {
+		return nil, fmt.Errorf("unable to create the config-folder: %v", errMkdir)
+	}
+
+	return lockFile(s.GetLockFilePath(), configFilePerms)
 }
 
-func (s *SettingsService) WriteSettings(settings *linkquisition.Settings) error {
-	data, err := json.MarshalIndent(settings, "", "  ")
+// WriteSettings writes the user's own settings, without anything merged from the drop-ins or the policies, to the
+// config-file stamped with the current version of the format. A config-file of an older version is backed up next to it
+// before it's replaced. The JSON Schema of the config-file is written next to it for the editors to find via `$schema`.
+//
+// The settings replace the config-file as a whole, so any changes made to it since the settings were read are lost:
+// use UpdateSettings for changing the settings instead.
+func (s *SettingsService) WriteSettings(settings *linkquisition.Settings, change linkquisition.SettingsChange) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.writeSettings(settings, change)
+}
+
+// writeSettings is WriteSettings for when the lock is already held. The files are replaced atomically, so a reader
+// never sees them half-written. The config-file as it was is recorded in the history, unless nothing changed.
+func (s *SettingsService) writeSettings(settings *linkquisition.Settings, change linkquisition.SettingsChange) error {
+	settings.Version = linkquisition.SettingsVersion
+	settings.Schema = "./" + filepath.Base(s.GetSchemaFilePath())
+
+	// only the user's own settings are written, never the ones merged from the drop-ins or the policies
+	if err := settings.CheckDropInValues(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(settings.WithoutDropIns(), "", "  ")
 	if err != nil {
 		return fmt.Errorf("unable to marshal settings: %v", err)
 	}
 
+	schema, err := json.MarshalIndent(linkquisition.GetSettingsSchema(s.PluginSchemas), "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal the schema: %v", err)
+	}
+
 	// ensure the directory exists
 	if errMkdir := os.MkdirAll(s.GetConfigFolderPath(), configDirPerms); errMkdir != nil {
 		return fmt.Errorf("failed to write settings: %v", errMkdir)
 	}
 
-	if errWrite := os.WriteFile(s.GetConfigFilePath(), data, configFilePerms); errWrite != nil {
+	if errWrite := writeFileAtomically(s.GetSchemaFilePath(), schema, configFilePerms); errWrite != nil {
+		return fmt.Errorf("failed to write the schema: %v", errWrite)
+	}
+
+	previous, errRead := os.ReadFile(s.GetConfigFilePath())
+	if errRead != nil && !errors.Is(errRead, os.ErrNotExist) {
+		return fmt.Errorf("failed to write settings: %v", errRead)
+	}
+	if bytes.Equal(previous, data) {
+		return nil
+	}
+
+	if errBackup := s.backupOldVersion(previous); errBackup != nil {
+		return fmt.Errorf("failed to back up the config-file: %v", errBackup)
+	}
+
+	if errHistory := s.recordChange(change, previous); errHistory != nil {
+		return fmt.Errorf("failed to record the change in the history: %v", errHistory)
+	}
+
+	s.invalidateCache()
+
+	if errWrite := writeFileAtomically(s.GetConfigFilePath(), data, configFilePerms); errWrite != nil {
 		return fmt.Errorf("failed to write settings: %v", errWrite)
 	}
 
 	return nil
 }
 
+// UpdateSettings reads the settings, applies the given update to them and writes them back, all while holding the lock
+// on the config-file so that no concurrent update gets lost. Without a config-file the update is applied to the
+// default settings. Nothing is written if the update returns an error, or if the config-file can't be read.
+func (s *SettingsService) UpdateSettings(
+	change linkquisition.SettingsChange,
+	update func(settings *linkquisition.Settings) error,
+) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	settings, err := s.ReadSettings()
+	if errors.Is(err, os.ErrNotExist) {
+		settings, err = s.getDefaultSettings(), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := update(settings); err != nil {
+		return err
+	}
+
+	return s.writeSettings(settings, change)
+}
+
+// IsConfigured returns true if the config-file exists and can be read. A config-file that exists but can't be used
+// results in a linkquisition.SettingsParseError.
 func (s *SettingsService) IsConfigured() (bool, error) {
 	if _, err := os.Stat(s.GetConfigFilePath()); errors.Is(err, os.ErrNotExist) {
 		return false, nil
@@ -123,51 +379,60 @@ func (s *SettingsService) IsConfigured() (bool, error) {
 	return err == nil, err
 }
 
+// GetSettings returns the settings read from the config-file, or the default settings if there's no usable one, in
+// which case IsConfigured tells why. The drop-ins, the subscriptions and the policies are in effect either way.
 func (s *SettingsService) GetSettings() *linkquisition.Settings {
-	isConfigured, err := s.IsConfigured()
-	if !isConfigured || err != nil {
-		return linkquisition.GetDefaultSettings()
+	if settings, err := s.ReadSettings(); err == nil {
+		return settings
 	}
 
-	settings, err := s.ReadSettings()
-	if err != nil {
-		return linkquisition.GetDefaultSettings()
+	return s.getDefaultSettings()
+}
+
+// getDefaultSettings returns the default settings in place of the user's own config-file, with the drop-ins and the
+// subscriptions merged into them and the policies applied over them
+func (s *SettingsService) getDefaultSettings() *linkquisition.Settings {
+	settings := linkquisition.GetDefaultSettings()
+
+	// the default log-level only applies if no drop-in sets one
+	logLevel := settings.LogLevel
+	settings.LogLevel = ""
+
+	s.mergeDropIns(settings)
+	s.mergeSubscriptions(settings)
+	s.applyPolicies(settings)
+
+	if settings.LogLevel == "" {
+		settings.LogLevel = logLevel
 	}
 
 	return settings
 }
 
 func (s *SettingsService) ScanBrowsers() error {
-	var oldSettings *linkquisition.Settings
-
-	if isConfigured, configErr := s.IsConfigured(); !isConfigured || configErr != nil {
-		oldSettings = &linkquisition.Settings{}
-	} else {
-		var err error
-		if oldSettings, err = s.ReadSettings(); err != nil {
-			return fmt.Errorf("failed to scan browsers: %v", err)
-		}
-	}
-
 	browsers, err := s.BrowserService.GetAvailableBrowsers()
 	if err != nil {
 		return fmt.Errorf("failed to scan browsers: %v", err)
 	}
 
-	newSettings := oldSettings.UpdateWithBrowsers(browsers).NormalizeBrowsers()
-
-	// ensure the directory exists
-	if errMkdir := os.MkdirAll(s.GetConfigFolderPath(), configDirPerms); errMkdir != nil {
-		return fmt.Errorf("failed to scan browsers: %v", errMkdir)
-	}
-
-	data, err := json.MarshalIndent(newSettings, "", "  ")
+	unlock, err := s.lock()
 	if err != nil {
 		return fmt.Errorf("failed to scan browsers: %v", err)
 	}
+	defer unlock()
+
+	// the scan only ever adds to the user's own config-file: a broken one is left for the user to fix
+	oldSettings, err := s.readConfigFile()
+	if errors.Is(err, os.ErrNotExist) {
+		oldSettings = &linkquisition.Settings{}
+	} else if err != nil {
+		return fmt.Errorf("failed to scan browsers: %w", err)
+	}
+
+	newSettings := oldSettings.UpdateWithBrowsers(browsers).NormalizeBrowsers()
 
-	//nolint:mnd
-	if err := os.WriteFile(s.GetConfigFilePath(), data, 0600); err != nil {
+	change := linkquisition.SettingsChange{Kind: linkquisition.SettingsChangeScan, Description: "scanned the browsers"}
+	if err := s.writeSettings(newSettings, change); err != nil {
 		return fmt.Errorf("failed to scan browsers: %v", err)
 	}
 
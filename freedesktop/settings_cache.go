@@ -0,0 +1,98 @@
+package freedesktop
+
+import (
+	"errors"
+	"os"
+	"slices"
+
+	"github.com/strobotti/linkquisition"
+)
+
+// cachedSettings holds the settings as they were read along with the state of the files they were read from
+type cachedSettings struct {
+	settings *linkquisition.Settings
+	files    []settingsFile
+
+	// subscriptionFiles holds the state of the files of the subscriptions, which are listed in the settings themselves
+	subscriptionFiles []settingsFile
+}
+
+// settingsFile is the state of a single file the settings are read from; info is nil if the file doesn't exist
+type settingsFile struct {
+	path string
+	info os.FileInfo
+}
+
+// unchanged returns true if the file is still the same one, with the same size and modification time. The config-file
+// is replaced rather than written to, so a change shows up as a different file even within the resolution of the
+// modification time.
+func (f settingsFile) unchanged(other settingsFile) bool {
+	if f.path != other.path || (f.info == nil) != (other.info == nil) {
+		return false
+	}
+
+	return f.info == nil ||
+		(os.SameFile(f.info, other.info) && f.info.Size() == other.info.Size() && f.info.ModTime().Equal(other.info.ModTime()))
+}
+
+// statSettingsFiles returns the state of the config-file, the drop-ins and the policies, or nil if any of them can't be
+// checked, in which case the settings aren't cached either
+func (s *SettingsService) statSettingsFiles() []settingsFile {
+	dropIns, err := s.getDropInFilePaths()
+	if err != nil {
+		return nil
+	}
+
+	paths := append([]string{s.GetConfigFilePath()}, dropIns...)
+	paths = append(paths, s.GetPolicyFilePaths()...)
+
+	files := make([]settingsFile, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		files = append(files, settingsFile{path: path, info: info})
+	}
+
+	return files
+}
+
+// getCached returns a copy of the cached settings if they were read from the files in the given state, or nil
+func (s *SettingsService) getCached(files []settingsFile) *linkquisition.Settings {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	if s.cache == nil || files == nil || !slices.EqualFunc(s.cache.files, files, settingsFile.unchanged) {
+		return nil
+	}
+
+	for _, file := range s.cache.subscriptionFiles {
+		info, _ := os.Stat(file.path)
+		if !file.unchanged(settingsFile{path: file.path, info: info}) {
+			return nil
+		}
+	}
+
+	return s.cache.settings.Clone()
+}
+
+// setCached caches a copy of the settings read from the files, and the files of the subscriptions, in the given state
+func (s *SettingsService) setCached(settings *linkquisition.Settings, files, subscriptionFiles []settingsFile) {
+	if files == nil {
+		return
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	s.cache = &cachedSettings{settings: settings.Clone(), files: files, subscriptionFiles: subscriptionFiles}
+}
+
+// invalidateCache makes the next read parse the settings again
+func (s *SettingsService) invalidateCache() {
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	s.cache = nil
+}
@@ -0,0 +1,173 @@
+package freedesktop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/strobotti/linkquisition"
+)
+
+// SettingsHistoryLimit is the number of changes kept in the history; the oldest ones are removed as new ones come
+const SettingsHistoryLimit = 50
+
+// GetHistoryFolderPath returns the path to the folder of the history of the config-file, one file per change. The
+// history is kept in the state folder, next to the log-file, rather than among the configuration the users may sync.
+func (s *SettingsService) GetHistoryFolderPath() string {
+	return filepath.Join(s.GetLogFolderPath(), "history")
+}
+
+// GetSettingsHistory returns the changes recorded in the history of the config-file, the latest first
+func (s *SettingsService) GetSettingsHistory() ([]linkquisition.SettingsHistoryEntry, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	paths, err := s.getHistoryFilePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]linkquisition.SettingsHistoryEntry, 0, len(paths))
+	for _, path := range paths {
+		entry, err := readHistoryEntry(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+// UndoSettingsChanges restores the config-file as it was before the given number of the latest changes and removes
+// the changes from the history
+func (s *SettingsService) UndoSettingsChanges(count int) ([]linkquisition.SettingsHistoryEntry, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	paths, err := s.getHistoryFilePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	if count < 1 || count > len(paths) {
+		return nil, fmt.Errorf("%w: %d changes requested, %d in the history", linkquisition.ErrNothingToUndo, count, len(paths))
+	}
+
+	undone := make([]linkquisition.SettingsHistoryEntry, 0, count)
+	for _, path := range paths[:count] {
+		entry, err := readHistoryEntry(path)
+		if err != nil {
+			return nil, err
+		}
+		undone = append(undone, *entry)
+	}
+
+	s.invalidateCache()
+
+	restored := undone[count-1].Previous
+	if restored == "" {
+		err = os.Remove(s.GetConfigFilePath())
+	} else {
+		err = writeFileAtomically(s.GetConfigFilePath(), []byte(restored), configFilePerms)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("unable to restore the config-file: %v", err)
+	}
+
+	for _, path := range paths[:count] {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("unable to remove the change `%s` from the history: %v", path, err)
+		}
+	}
+
+	return undone, nil
+}
+
+// recordChange adds the change to the history along with the config-file as it was before it, removing the oldest
+// changes beyond SettingsHistoryLimit
+func (s *SettingsService) recordChange(change linkquisition.SettingsChange, previous []byte) error {
+	if err := os.MkdirAll(s.GetHistoryFolderPath(), configDirPerms); err != nil {
+		return err
+	}
+
+	paths, err := s.getHistoryFilePaths()
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(paths) > 0 {
+		next = historySequence(paths[0]) + 1
+	}
+
+	data, err := json.MarshalIndent(linkquisition.SettingsHistoryEntry{
+		SettingsChange: change,
+		Time:           time.Now(),
+		Previous:       string(previous),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.GetHistoryFolderPath(), fmt.Sprintf("%08d.json", next))
+	if err := writeFileAtomically(path, data, configFilePerms); err != nil {
+		return err
+	}
+
+	// the new change isn't among the paths, so one less of the old ones is kept
+	for _, path := range paths[min(len(paths), SettingsHistoryLimit-1):] {
+		_ = os.Remove(path)
+	}
+
+	return nil
+}
+
+// getHistoryFilePaths returns the paths to the changes in the history, the latest first
+func (s *SettingsService) getHistoryFilePaths() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(s.GetHistoryFolderPath(), "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the history: %v", err)
+	}
+
+	paths = slices.DeleteFunc(paths, func(path string) bool { return historySequence(path) == 0 })
+	slices.SortFunc(paths, func(a, b string) int { return historySequence(b) - historySequence(a) })
+
+	return paths, nil
+}
+
+// historySequence returns the sequence number of the change in the history, or 0 for any other file
+func historySequence(path string) int {
+	sequence, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(path), ".json"))
+	if err != nil || sequence < 1 {
+		return 0
+	}
+
+	return sequence
+}
+
+func readHistoryEntry(path string) (*linkquisition.SettingsHistoryEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the change `%s` for reading: %v", path, err)
+	}
+
+	var entry linkquisition.SettingsHistoryEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("unable to parse the change `%s`: %v", path, err)
+	}
+
+	return &entry, nil
+}
@@ -0,0 +1,245 @@
+package freedesktop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/strobotti/linkquisition"
+)
+
+// subscriptionRequestTimeout limits fetching a single subscription
+const subscriptionRequestTimeout = 5 * time.Second
+
+// subscriptionRetryDelay is how long a subscription that failed to fetch is left alone; the delay doubles with each
+// failure in a row, up to the refresh interval of the subscription
+const subscriptionRetryDelay = time.Minute
+
+// subscriptionMaxSize limits the size of a subscribed file
+const subscriptionMaxSize = 4 << 20
+
+// subscriptionMeta is stored next to a fetched subscription for refreshing it
+type subscriptionMeta struct {
+	ETag      string    `json:"etag,omitempty"`
+	FetchedAt time.Time `json:"fetchedAt"`
+
+	// Failures is the number of failed attempts in a row, the latest at FailedAt
+	Failures int       `json:"failures,omitempty"`
+	FailedAt time.Time `json:"failedAt,omitzero"`
+}
+
+// retryAt returns when the subscription may be fetched again after the failed attempts
+func (m *subscriptionMeta) retryAt(interval time.Duration) time.Time {
+	// after enough failures the delay is the interval anyway, before the shift overflows
+	delay := interval
+	if m.Failures < 16 { //nolint:mnd
+		delay = min(subscriptionRetryDelay<<(m.Failures-1), interval)
+	}
+
+	return m.FailedAt.Add(delay)
+}
+
+// GetSubscriptionCacheFolderPath returns the path to the folder the subscriptions to the URLs are fetched to, following
+// XDG_CACHE_HOME (default: ~/.cache)
+func (s *SettingsService) GetSubscriptionCacheFolderPath() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "linkquisition", "subscriptions")
+	}
+
+	return filepath.Join(cacheDir, "linkquisition", "subscriptions")
+}
+
+// getSubscriptionFilePath returns the path to the file the rules of the subscription are read from: the source itself
+// for a local file, or the copy fetched to the cache for a URL
+func (s *SettingsService) getSubscriptionFilePath(subscription *linkquisition.Subscription) string {
+	if !subscription.IsRemote() {
+		return subscription.Source
+	}
+
+	sum := sha256.Sum256([]byte(subscription.Source))
+
+	return filepath.Join(s.GetSubscriptionCacheFolderPath(), hex.EncodeToString(sum[:16])+".json")
+}
+
+func (s *SettingsService) getSubscriptionMetaFilePath(subscription *linkquisition.Subscription) string {
+	return s.getSubscriptionFilePath(subscription) + ".meta"
+}
+
+// mergeSubscriptions merges the rules of the enabled subscriptions into the settings, returning the state of the files
+// they were read from for caching the settings. A subscription that hasn't been fetched yet, or can't be read or
+// parsed, is left out rather than failing the whole settings: the rules are shared, not the user's own.
+func (s *SettingsService) mergeSubscriptions(settings *linkquisition.Settings) []settingsFile {
+	var files []settingsFile
+
+	for i := range settings.Subscriptions {
+		subscription := &settings.Subscriptions[i]
+		if subscription.IsDisabled || subscription.Source == "" {
+			continue
+		}
+		if err := subscription.Validate(); err != nil {
+			s.logger().Warn("the subscription is ignored", "source", subscription.Source, "error", err.Error())
+			continue
+		}
+
+		path := s.getSubscriptionFilePath(subscription)
+
+		info, _ := os.Stat(path)
+		files = append(files, settingsFile{path: path, info: info})
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		subscribed, _, err := linkquisition.ParseSettings(data, subscription.Source)
+		if err != nil {
+			continue
+		}
+
+		settings.MergeSubscription(subscribed, subscription.Source)
+	}
+
+	return files
+}
+
+// RefreshSubscriptions fetches the subscriptions to the URLs which are due for a refresh, or all of them if forced.
+// The ETag of the fetched file is sent along with the next request, so that an unchanged file isn't transferred again.
+// A file that fails to fetch or to parse leaves the previously fetched one in place, and isn't due again until a delay
+// growing with each failure has passed; the errors are joined.
+func (s *SettingsService) RefreshSubscriptions(force bool) error {
+	settings := s.GetSettings()
+
+	var errs []error
+
+	for i := range settings.Subscriptions {
+		subscription := &settings.Subscriptions[i]
+		if subscription.IsDisabled || !subscription.IsRemote() {
+			continue
+		}
+
+		err := subscription.Validate()
+		if err == nil {
+			err = s.refreshSubscription(subscription, force)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to refresh the subscription `%s`: %w", subscription.Source, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *SettingsService) refreshSubscription(subscription *linkquisition.Subscription, force bool) error {
+	path := s.getSubscriptionFilePath(subscription)
+	metaPath := s.getSubscriptionMetaFilePath(subscription)
+	interval := subscription.GetRefreshInterval()
+
+	var meta subscriptionMeta
+	if data, err := os.ReadFile(metaPath); err == nil {
+		_ = json.Unmarshal(data, &meta)
+	}
+
+	_, errStat := os.Stat(path)
+	fetched := errStat == nil
+
+	if !force {
+		if fetched && time.Since(meta.FetchedAt) < interval {
+			return nil
+		}
+		if meta.Failures > 0 && time.Now().Before(meta.retryAt(interval)) {
+			return nil
+		}
+	}
+
+	etag := ""
+	if fetched {
+		etag = meta.ETag
+	}
+
+	etag, err := s.fetchSubscription(subscription, path, etag)
+	if err != nil {
+		meta.Failures++
+		meta.FailedAt = time.Now()
+	} else {
+		meta = subscriptionMeta{ETag: etag, FetchedAt: time.Now()}
+	}
+
+	data, errMarshal := json.Marshal(meta)
+	if errMarshal != nil {
+		return errors.Join(err, errMarshal)
+	}
+	if errDir := os.MkdirAll(s.GetSubscriptionCacheFolderPath(), configDirPerms); errDir != nil {
+		return errors.Join(err, errDir)
+	}
+
+	return errors.Join(err, writeFileAtomically(metaPath, data, configFilePerms))
+}
+
+// fetchSubscription fetches the file of the subscription to the given path, unless it still has the given ETag, and
+// returns the ETag of the file
+func (s *SettingsService) fetchSubscription(subscription *linkquisition.Subscription, path, etag string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), subscriptionRequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, subscription.Source, http.NoBody)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "linkquisition")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := s.getHttpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && etag != "":
+		return etag, nil
+	case resp.StatusCode == http.StatusOK:
+	default:
+		return "", fmt.Errorf("unexpected response `%s`", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, subscriptionMaxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > subscriptionMaxSize {
+		return "", fmt.Errorf("the file is larger than %d bytes", subscriptionMaxSize)
+	}
+
+	// a broken file would only be left out when reading the settings, so it's better not to replace a working one
+	if _, _, err := linkquisition.ParseSettings(data, subscription.Source); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(s.GetSubscriptionCacheFolderPath(), configDirPerms); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomically(path, data, configFilePerms); err != nil {
+		return "", err
+	}
+
+	return resp.Header.Get("ETag"), nil
+}
+
+func (s *SettingsService) getHttpClient() *http.Client {
+	if s.HttpClient != nil {
+		return s.HttpClient
+	}
+
+	return http.DefaultClient
+}
@@ -0,0 +1,776 @@
+package freedesktop_test
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/strobotti/linkquisition"
+	. "github.com/strobotti/linkquisition/freedesktop"
+)
+
+func TestSettingsService_ReadSettings_MigratesOldConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	service := &SettingsService{}
+	oldConfig := []byte(`{"browsers": [{"name": "Firefox", "command": "firefox %u", "matches": [{"type": "site", "value": "example.com"}]}]}`)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(service.GetConfigFilePath()), 0o700))
+	require.NoError(t, os.WriteFile(service.GetConfigFilePath(), oldConfig, 0o600))
+
+	settings, err := service.ReadSettings()
+	require.NoError(t, err)
+	assert.Equal(t, linkquisition.SettingsVersion, settings.Version)
+	assert.Equal(t, "Firefox", settings.Browsers[0].Name)
+
+	// reading never writes: the config-file is migrated in memory only
+	data, err := os.ReadFile(service.GetConfigFilePath())
+	require.NoError(t, err)
+	assert.Equal(t, oldConfig, data)
+	assert.NoFileExists(t, service.GetBackupFilePath(0))
+
+	// the migrated config-file is stored on the next write, with the original backed up
+	require.NoError(t, service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+		settings.AddRuleToBrowser(&linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}, linkquisition.BrowserMatchTypeSite, "www.example.org")
+		return nil
+	}))
+
+	backup, err := os.ReadFile(service.GetBackupFilePath(0))
+	require.NoError(t, err)
+	assert.Equal(t, oldConfig, backup)
+
+	data, err = os.ReadFile(service.GetConfigFilePath())
+	require.NoError(t, err)
+	assert.Contains(t, string(data), fmt.Sprintf(`"version": %d`, linkquisition.SettingsVersion))
+
+	// the config-file of the current version isn't backed up again
+	require.NoError(t, os.Remove(service.GetBackupFilePath(0)))
+	require.NoError(t, service.WriteSettings(linkquisition.GetDefaultSettings(), testChange))
+	assert.NoFileExists(t, service.GetBackupFilePath(0))
+}
+
+func TestSettingsService_ReadSettings_RefusesNewerConfig(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	service := &SettingsService{}
+	newConfig := []byte(`{"version": 999, "browsers": []}`)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(service.GetConfigFilePath()), 0o700))
+	require.NoError(t, os.WriteFile(service.GetConfigFilePath(), newConfig, 0o600))
+
+	_, err := service.ReadSettings()
+	require.ErrorIs(t, err, linkquisition.ErrSettingsTooNew)
+
+	// the config-file is left untouched
+	data, err := os.ReadFile(service.GetConfigFilePath())
+	require.NoError(t, err)
+	assert.Equal(t, newConfig, data)
+}
+
+func TestSettingsService_WriteSettings_WritesSchema(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	service := &SettingsService{
+		PluginSchemas: map[string]map[string]any{"unwrap.so": {"type": "object"}},
+	}
+
+	require.NoError(t, service.WriteSettings(linkquisition.GetDefaultSettings(), testChange))
+
+	settings, err := service.ReadSettings()
+	require.NoError(t, err)
+	assert.Equal(t, "./config.schema.json", settings.Schema)
+
+	schema, err := os.ReadFile(service.GetSchemaFilePath())
+	require.NoError(t, err)
+	assert.Contains(t, string(schema), `"const": "unwrap.so"`)
+}
+
+func TestSettingsService_WriteSettings_FollowsSymlink(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	service := &SettingsService{}
+	dotfiles := t.TempDir()
+	target := filepath.Join(dotfiles, "linkquisition.json")
+
+	require.NoError(t, os.WriteFile(target, []byte(`{"version": 1, "browsers": []}`), 0o600))
+	require.NoError(t, os.MkdirAll(service.GetConfigFolderPath(), 0o700))
+	require.NoError(t, os.Symlink(target, service.GetConfigFilePath()))
+
+	settings := linkquisition.GetDefaultSettings()
+	settings.Browsers = []linkquisition.BrowserSettings{{Name: "Firefox", Command: "firefox %u"}}
+	require.NoError(t, service.WriteSettings(settings, testChange))
+
+	link, err := os.Readlink(service.GetConfigFilePath())
+	require.NoError(t, err)
+	assert.Equal(t, target, link)
+
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Firefox"`)
+
+	entries, err := os.ReadDir(dotfiles)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+}
+
+func TestSettingsService_DropIns(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	service := &SettingsService{}
+	ownConfig := `{"version": 1, "browsers": [{"name": "Firefox", "command": "firefox %u", "matches": []}]}`
+	dropIns := map[string]string{
+		"20-personal-overrides.json": `{"browsers": [{"name": "Chromium", "command": "chromium %U"}], "logLevel": "warn"}`,
+		"10-team.json":               `{"browsers": [{"name": "Firefox", "command": "firefox %u", "matches": [{"type": "domain", "value": "corp.example"}]}], "logLevel": "debug"}`,
+		"README.txt":                 `not a drop-in`,
+	}
+
+	require.NoError(t, os.MkdirAll(service.GetDropInFolderPath(), 0o700))
+	require.NoError(t, os.WriteFile(service.GetConfigFilePath(), []byte(ownConfig), 0o600))
+	for name, content := range dropIns {
+		require.NoError(t, os.WriteFile(filepath.Join(service.GetDropInFolderPath(), name), []byte(content), 0o600))
+	}
+
+	settings, err := service.ReadSettings()
+	require.NoError(t, err)
+	assert.Equal(t, "debug", settings.LogLevel)
+	require.Len(t, settings.Browsers, 2)
+	assert.Equal(t, "corp.example", settings.Browsers[0].Matches[0].Value)
+	assert.Equal(t, filepath.Join(service.GetDropInFolderPath(), "10-team.json"), settings.Browsers[0].Matches[0].Origin)
+
+	// remembering a choice only ever adds the rule to the user's own config-file
+	settings.AddRuleToBrowser(&linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}, linkquisition.BrowserMatchTypeSite, "www.example.com")
+	require.NoError(t, service.WriteSettings(settings, testChange))
+
+	written, err := os.ReadFile(service.GetConfigFilePath())
+	require.NoError(t, err)
+	assert.NotContains(t, string(written), "corp.example")
+	assert.NotContains(t, string(written), "Chromium")
+	assert.NotContains(t, string(written), "debug")
+
+	settings, err = service.ReadSettings()
+	require.NoError(t, err)
+	require.Len(t, settings.Browsers[0].Matches, 2)
+	assert.Equal(t, "www.example.com", settings.Browsers[0].Matches[0].Value)
+	assert.Equal(t, "corp.example", settings.Browsers[0].Matches[1].Value)
+
+	t.Run("without a config-file the drop-ins are in effect", func(t *testing.T) {
+		require.NoError(t, os.Rename(service.GetConfigFilePath(), service.GetConfigFilePath()+".orig"))
+		defer func() {
+			require.NoError(t, os.Rename(service.GetConfigFilePath()+".orig", service.GetConfigFilePath()))
+		}()
+
+		settings := service.GetSettings()
+		assert.Equal(t, "debug", settings.LogLevel)
+		require.Len(t, settings.Browsers, 2)
+		assert.Equal(t, "corp.example", settings.Browsers[0].Matches[0].Value)
+
+		require.NoError(t, service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+			require.Len(t, settings.Browsers, 2)
+			settings.AddRuleToBrowser(&linkquisition.Browser{Name: "Chromium", Command: "chromium %U"}, linkquisition.BrowserMatchTypeSite, "meet.example.com")
+			return nil
+		}))
+
+		written, err := os.ReadFile(service.GetConfigFilePath())
+		require.NoError(t, err)
+		assert.Contains(t, string(written), "meet.example.com")
+		assert.NotContains(t, string(written), "corp.example")
+		assert.NotContains(t, string(written), "debug")
+
+		require.NoError(t, os.Remove(service.GetConfigFilePath()))
+	})
+
+	t.Run("a broken drop-in is logged and left out", func(t *testing.T) {
+		var logged bytes.Buffer
+		service.Logger = slog.New(slog.NewTextHandler(&logged, nil))
+		brokenPath := filepath.Join(service.GetDropInFolderPath(), "30-broken.json")
+		require.NoError(t, os.WriteFile(brokenPath, []byte(`{"browsers": [`), 0o600))
+
+		isConfigured, err := service.IsConfigured()
+		require.NoError(t, err)
+		assert.True(t, isConfigured)
+
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		require.Len(t, settings.Browsers[0].Matches, 2)
+		assert.Contains(t, logged.String(), brokenPath)
+	})
+}
+
+func TestSettingsService_Policies(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	systemDir, vendorDir := t.TempDir(), t.TempDir()
+	t.Setenv("XDG_CONFIG_DIRS", systemDir+":"+vendorDir)
+
+	service := &SettingsService{}
+	assert.Equal(
+		t,
+		[]string{filepath.Join(systemDir, "linkquisition", "policy.json"), filepath.Join(vendorDir, "linkquisition", "policy.json")},
+		service.GetPolicyFilePaths(),
+	)
+
+	ownConfig := `{"version": 1, "browsers": [{"name": "Firefox", "command": "firefox %u", "matches": []}]}`
+	policy := `{"browsers": [{"name": "Chrome", "command": "google-chrome %U", "matches": [{"type": "site", "value": "sso.corp.example"}]}]}`
+
+	require.NoError(t, os.MkdirAll(service.GetConfigFolderPath(), 0o700))
+	require.NoError(t, os.WriteFile(service.GetConfigFilePath(), []byte(ownConfig), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, "linkquisition"), 0o700))
+	require.NoError(t, os.WriteFile(service.GetPolicyFilePaths()[1], []byte(policy), 0o600))
+
+	settings, err := service.ReadSettings()
+	require.NoError(t, err)
+	assert.True(t, settings.IsLocked("https://sso.corp.example/"))
+
+	// the user's rule for the same site is stored but has no effect
+	settings.AddRuleToBrowser(&linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}, linkquisition.BrowserMatchTypeSite, "sso.corp.example")
+	require.NoError(t, service.WriteSettings(settings, testChange))
+
+	written, err := os.ReadFile(service.GetConfigFilePath())
+	require.NoError(t, err)
+	assert.NotContains(t, string(written), "Chrome")
+
+	settings, err = service.ReadSettings()
+	require.NoError(t, err)
+	browser, err := settings.GetMatchingBrowser("https://sso.corp.example/")
+	require.NoError(t, err)
+	assert.Equal(t, "Chrome", browser.Name)
+
+	t.Run("a broken policy is logged and leaves the rest in effect", func(t *testing.T) {
+		var logged bytes.Buffer
+		service.Logger = slog.New(slog.NewTextHandler(&logged, nil))
+		require.NoError(t, os.MkdirAll(filepath.Join(systemDir, "linkquisition"), 0o700))
+		require.NoError(t, os.WriteFile(service.GetPolicyFilePaths()[0], []byte(`{"rules": [`), 0o600))
+		defer func() { _ = os.Remove(service.GetPolicyFilePaths()[0]) }()
+
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		assert.Equal(t, "Firefox", settings.Browsers[0].Name)
+		assert.True(t, settings.IsLocked("https://sso.corp.example/"))
+		assert.Contains(t, logged.String(), "level=ERROR")
+		assert.Contains(t, logged.String(), service.GetPolicyFilePaths()[0])
+	})
+
+	// the policies are in effect even without a config-file
+	require.NoError(t, os.Remove(service.GetConfigFilePath()))
+	assert.True(t, service.GetSettings().IsLocked("https://sso.corp.example/"))
+}
+
+func TestSettingsService_UpdateSettings_Concurrently(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	const writers = 20
+
+	service := &SettingsService{}
+	firefox := &linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}
+
+	require.NoError(t, service.WriteSettings(&linkquisition.Settings{
+		Browsers: []linkquisition.BrowserSettings{{Name: firefox.Name, Command: firefox.Command, Matches: []linkquisition.BrowserMatch{}}},
+	}, testChange))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*writers)
+
+	for i := range writers {
+		wg.Go(func() {
+			errs <- service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+				settings.AddRuleToBrowser(firefox, linkquisition.BrowserMatchTypeSite, fmt.Sprintf("site%d.example", i))
+				return nil
+			})
+		})
+
+		// the readers never see the config-file half-written
+		wg.Go(func() {
+			_, err := service.ReadSettings()
+			errs <- err
+		})
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	settings, err := service.ReadSettings()
+	require.NoError(t, err)
+	assert.Len(t, settings.Browsers[0].Matches, writers)
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(service.GetConfigFolderPath())
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".tmp")
+	}
+}
+
+func TestSettingsService_ReadSettings_TakesNoLock(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_DIRS", t.TempDir())
+
+	service := &SettingsService{}
+
+	require.NoError(t, os.MkdirAll(service.GetConfigFolderPath(), 0o700))
+	require.NoError(t, os.WriteFile(service.GetConfigFilePath(), []byte(`{"version": 1, "browsers": []}`), 0o600))
+
+	_, err := service.ReadSettings()
+	require.NoError(t, err)
+	assert.NoFileExists(t, service.GetLockFilePath())
+
+	// a read doesn't wait for an update in progress, which would never finish otherwise
+	require.NoError(t, service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+		_, err := (&SettingsService{}).ReadSettings()
+		return err
+	}))
+}
+
+func TestSettingsService_UpdateSettings(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		config          string
+		updateErr       error
+		expectedErr     bool
+		expectedWritten string
+	}{
+		{
+			name:            "without a config-file the update is applied to the default settings",
+			expectedWritten: "www.example.com",
+		},
+		{
+			name:        "a broken config-file is left untouched",
+			config:      `{"version": 1, "browsers": [`,
+			expectedErr: true,
+		},
+		{
+			name:        "nothing is written if the update fails",
+			config:      `{"version": 1, "browsers": []}`,
+			updateErr:   fmt.Errorf("failed"),
+			expectedErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+			service := &SettingsService{}
+
+			if tt.config != "" {
+				require.NoError(t, os.MkdirAll(service.GetConfigFolderPath(), 0o700))
+				require.NoError(t, os.WriteFile(service.GetConfigFilePath(), []byte(tt.config), 0o600))
+			}
+
+			err := service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+				settings.Browsers = append(settings.Browsers, linkquisition.BrowserSettings{
+					Name: "Firefox", Command: "firefox %u", Matches: []linkquisition.BrowserMatch{{Type: linkquisition.BrowserMatchTypeSite, Value: "www.example.com"}},
+				})
+				return tt.updateErr
+			})
+
+			written, readErr := os.ReadFile(service.GetConfigFilePath())
+
+			if tt.expectedErr {
+				require.Error(t, err)
+				if tt.config == "" {
+					assert.ErrorIs(t, readErr, os.ErrNotExist)
+				} else {
+					assert.Equal(t, tt.config, string(written))
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.NoError(t, readErr)
+			assert.Contains(t, string(written), tt.expectedWritten)
+		})
+	}
+}
+
+func TestSettingsService_ReadSettings_Cache(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_DIRS", t.TempDir())
+
+	service := &SettingsService{}
+	firefox := &linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}
+
+	require.NoError(t, service.WriteSettings(&linkquisition.Settings{
+		Browsers: []linkquisition.BrowserSettings{{Name: firefox.Name, Command: firefox.Command, Matches: []linkquisition.BrowserMatch{}}},
+	}, testChange))
+
+	t.Run("the settings read can be changed without affecting the next read", func(t *testing.T) {
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		settings.AddRuleToBrowser(firefox, linkquisition.BrowserMatchTypeSite, "www.example.com")
+
+		settings, err = service.ReadSettings()
+		require.NoError(t, err)
+		assert.Empty(t, settings.Browsers[0].Matches)
+	})
+
+	t.Run("a change made by another process is noticed", func(t *testing.T) {
+		other := &SettingsService{}
+		require.NoError(t, other.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+			settings.AddRuleToBrowser(firefox, linkquisition.BrowserMatchTypeSite, "www.example.com")
+			return nil
+		}))
+
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		assert.Len(t, settings.Browsers[0].Matches, 1)
+	})
+
+	t.Run("a new drop-in is noticed", func(t *testing.T) {
+		require.NoError(t, os.MkdirAll(service.GetDropInFolderPath(), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(service.GetDropInFolderPath(), "10-team.json"), []byte(`{"logLevel": "debug"}`), 0o600))
+
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		assert.Equal(t, "debug", settings.LogLevel)
+	})
+
+	t.Run("a broken config-file is reported rather than cached over", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(service.GetConfigFilePath(), []byte(`{"version": 1, "browsers": [`), 0o600))
+
+		isConfigured, err := service.IsConfigured()
+		assert.False(t, isConfigured)
+
+		var parseErr *linkquisition.SettingsParseError
+		require.ErrorAs(t, err, &parseErr)
+		assert.Equal(t, service.GetConfigFilePath(), parseErr.Path)
+		assert.Equal(t, 1, parseErr.Line)
+
+		// GetSettings falls back to the defaults, the reason being available through IsConfigured
+		assert.Equal(t, linkquisition.GetDefaultSettings().Browsers, service.GetSettings().Browsers)
+	})
+}
+
+func TestSettingsService_Subscriptions_RetryDelay(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_DIRS", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	service := &SettingsService{HttpClient: server.Client()}
+	require.NoError(t, service.WriteSettings(&linkquisition.Settings{
+		Browsers:      []linkquisition.BrowserSettings{},
+		Subscriptions: []linkquisition.Subscription{{Source: server.URL + "/rules.json"}},
+	}, testChange))
+
+	require.Error(t, service.RefreshSubscriptions(false))
+	assert.Equal(t, int32(1), requests.Load())
+
+	// a failed subscription isn't due again right away
+	require.NoError(t, service.RefreshSubscriptions(false))
+	assert.Equal(t, int32(1), requests.Load())
+
+	require.Error(t, service.RefreshSubscriptions(true))
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestSettingsService_ScanBrowsers(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_DIRS", t.TempDir())
+
+	service := &SettingsService{BrowserService: &scannedBrowsers{browsers: []linkquisition.Browser{
+		{Name: "Firefox", Command: "firefox %u"},
+		{Name: "Chromium", Command: "chromium %U"},
+	}}}
+
+	t.Run("without a config-file the scanned browsers are written", func(t *testing.T) {
+		require.NoError(t, service.ScanBrowsers())
+
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		require.Len(t, settings.Browsers, 2)
+	})
+
+	require.NoError(t, service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+		settings.AddRuleToBrowser(&linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}, linkquisition.BrowserMatchTypeSite, "www.example.com")
+		return nil
+	}))
+
+	t.Run("a broken drop-in doesn't affect the scan", func(t *testing.T) {
+		require.NoError(t, os.MkdirAll(service.GetDropInFolderPath(), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(service.GetDropInFolderPath(), "10-team.json"), []byte(`{"browsers": [`), 0o600))
+
+		require.NoError(t, service.ScanBrowsers())
+
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		require.Len(t, settings.Browsers[0].Matches, 1)
+	})
+
+	t.Run("a broken config-file is left as it is", func(t *testing.T) {
+		broken := []byte(`{"version": 1, "browsers": [{"name": "Firefox", "command": "firefox %u", "matches": [`)
+		require.NoError(t, os.WriteFile(service.GetConfigFilePath(), broken, 0o600))
+
+		var parseErr *linkquisition.SettingsParseError
+		require.ErrorAs(t, service.ScanBrowsers(), &parseErr)
+
+		data, err := os.ReadFile(service.GetConfigFilePath())
+		require.NoError(t, err)
+		assert.Equal(t, broken, data)
+	})
+}
+
+// scannedBrowsers is a BrowserService finding the given browsers
+type scannedBrowsers struct {
+	linkquisition.BrowserService
+	browsers []linkquisition.Browser
+}
+
+func (s *scannedBrowsers) GetAvailableBrowsers() ([]linkquisition.Browser, error) {
+	return s.browsers, nil
+}
+
+var testChange = linkquisition.SettingsChange{Kind: linkquisition.SettingsChangeCommand, Description: "test"}
+
+func TestSettingsService_History(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+
+	service := &SettingsService{}
+	assert.Equal(t, filepath.Join(stateHome, "linkquisition", "history"), service.GetHistoryFolderPath())
+	firefox := &linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}
+	remember := func(site string) error {
+		change := linkquisition.SettingsChange{Kind: linkquisition.SettingsChangeRemember, Description: "remembered " + site}
+		return service.UpdateSettings(change, func(settings *linkquisition.Settings) error {
+			settings.AddRuleToBrowser(firefox, linkquisition.BrowserMatchTypeSite, site)
+			return nil
+		})
+	}
+
+	scan := linkquisition.SettingsChange{Kind: linkquisition.SettingsChangeScan, Description: "scanned the browsers"}
+	require.NoError(t, service.WriteSettings(&linkquisition.Settings{
+		Browsers: []linkquisition.BrowserSettings{{Name: firefox.Name, Command: firefox.Command, Matches: []linkquisition.BrowserMatch{}}},
+	}, scan))
+	scanned, err := os.ReadFile(service.GetConfigFilePath())
+	require.NoError(t, err)
+
+	require.NoError(t, remember("www.example.com"))
+	require.NoError(t, remember("www.example.org"))
+
+	// writing the same settings again isn't a change
+	settings, err := service.ReadSettings()
+	require.NoError(t, err)
+	require.NoError(t, service.WriteSettings(settings, testChange))
+
+	history, err := service.GetSettingsHistory()
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, "remembered www.example.org", history[0].Description)
+	assert.Equal(t, linkquisition.SettingsChangeRemember, history[1].Kind)
+	assert.Equal(t, linkquisition.SettingsChangeScan, history[2].Kind)
+	assert.Empty(t, history[2].Previous)
+
+	t.Run("undoing the latest change", func(t *testing.T) {
+		undone, err := service.UndoSettingsChanges(1)
+		require.NoError(t, err)
+		require.Len(t, undone, 1)
+		assert.Equal(t, "remembered www.example.org", undone[0].Description)
+
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		assert.Equal(t, []linkquisition.BrowserMatch{{Type: linkquisition.BrowserMatchTypeSite, Value: "www.example.com"}}, settings.Browsers[0].Matches)
+	})
+
+	t.Run("undoing more changes than recorded", func(t *testing.T) {
+		_, err := service.UndoSettingsChanges(3)
+		require.ErrorIs(t, err, linkquisition.ErrNothingToUndo)
+	})
+
+	t.Run("undoing the rest of the changes", func(t *testing.T) {
+		_, err := service.UndoSettingsChanges(1)
+		require.NoError(t, err)
+
+		restored, err := os.ReadFile(service.GetConfigFilePath())
+		require.NoError(t, err)
+		assert.Equal(t, scanned, restored)
+
+		_, err = service.UndoSettingsChanges(1)
+		require.NoError(t, err)
+		assert.NoFileExists(t, service.GetConfigFilePath())
+
+		history, err := service.GetSettingsHistory()
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+
+	t.Run("the oldest changes are rotated away", func(t *testing.T) {
+		require.NoError(t, service.WriteSettings(&linkquisition.Settings{
+			Browsers: []linkquisition.BrowserSettings{{Name: firefox.Name, Command: firefox.Command, Matches: []linkquisition.BrowserMatch{}}},
+		}, scan))
+
+		for i := range SettingsHistoryLimit + 5 {
+			require.NoError(t, remember(fmt.Sprintf("site%d.example", i)))
+		}
+
+		history, err := service.GetSettingsHistory()
+		require.NoError(t, err)
+		require.Len(t, history, SettingsHistoryLimit)
+		assert.Equal(t, fmt.Sprintf("remembered site%d.example", SettingsHistoryLimit+4), history[0].Description)
+	})
+}
+
+func TestSettingsService_Subscriptions(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_DIRS", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	var mu sync.Mutex
+	var requests []string
+	etag, body := `"v1"`, `{"rules": [{"type": "domain", "value": "corp.example", "action": "open", "role": "work"}]}`
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests = append(requests, r.Header.Get("If-None-Match"))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	serve := func(newEtag, newBody string) {
+		mu.Lock()
+		defer mu.Unlock()
+		etag, body = newEtag, newBody
+	}
+	sentEtags := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(requests)
+	}
+
+	localPath := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(localPath, []byte(`{"rules": [{"type": "site", "value": "local.example", "action": "open", "role": "work"}]}`), 0o600))
+
+	service := &SettingsService{HttpClient: server.Client()}
+	remote := server.URL + "/rules.json"
+
+	require.NoError(t, service.WriteSettings(&linkquisition.Settings{
+		Browsers: []linkquisition.BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u", Matches: []linkquisition.BrowserMatch{}},
+			{Name: "Chrome", Command: "google-chrome %U", Matches: []linkquisition.BrowserMatch{}, Roles: []string{"work"}},
+		},
+		Subscriptions: []linkquisition.Subscription{{Source: remote, Refresh: "1h"}, {Source: localPath}},
+	}, testChange))
+
+	matchingBrowser := func(t *testing.T, u string) string {
+		t.Helper()
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		browser, err := settings.GetMatchingBrowser(u)
+		if err != nil {
+			return ""
+		}
+		return browser.Name
+	}
+
+	t.Run("a local file is read as it is", func(t *testing.T) {
+		settings, err := service.ReadSettings()
+		require.NoError(t, err)
+		assert.Len(t, settings.GetSubscriptionRules(localPath), 1)
+		assert.Empty(t, settings.GetSubscriptionRules(remote))
+	})
+
+	t.Run("a URL is fetched and its rules bind to the browser of the role", func(t *testing.T) {
+		require.NoError(t, service.RefreshSubscriptions(false))
+		assert.Equal(t, []string{""}, sentEtags())
+		assert.Equal(t, "Chrome", matchingBrowser(t, "https://wiki.corp.example/"))
+	})
+
+	t.Run("a URL is not fetched again until it's due", func(t *testing.T) {
+		require.NoError(t, service.RefreshSubscriptions(false))
+		assert.Len(t, sentEtags(), 1)
+	})
+
+	t.Run("an unchanged file is not transferred again", func(t *testing.T) {
+		require.NoError(t, service.RefreshSubscriptions(true))
+		assert.Equal(t, []string{"", `"v1"`}, sentEtags())
+		assert.Equal(t, "Chrome", matchingBrowser(t, "https://wiki.corp.example/"))
+	})
+
+	t.Run("a changed file replaces the previous rules", func(t *testing.T) {
+		serve(`"v2"`, `{"rules": [{"type": "domain", "value": "corp2.example", "action": "open", "role": "work"}]}`)
+
+		require.NoError(t, service.RefreshSubscriptions(true))
+		assert.Equal(t, []string{"", `"v1"`, `"v1"`}, sentEtags())
+		assert.Equal(t, "", matchingBrowser(t, "https://wiki.corp.example/"))
+		assert.Equal(t, "Chrome", matchingBrowser(t, "https://wiki.corp2.example/"))
+	})
+
+	t.Run("a broken file keeps the previous rules in effect", func(t *testing.T) {
+		serve(`"v3"`, `{"rules": [`)
+
+		err := service.RefreshSubscriptions(true)
+		var parseErr *linkquisition.SettingsParseError
+		require.ErrorAs(t, err, &parseErr)
+		assert.Equal(t, remote, parseErr.Path)
+		assert.Equal(t, "Chrome", matchingBrowser(t, "https://wiki.corp2.example/"))
+	})
+
+	t.Run("a plain http URL is refused", func(t *testing.T) {
+		insecure := "http" + strings.TrimPrefix(remote, "https")
+		require.NoError(t, service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+			settings.Subscriptions = append(settings.Subscriptions, linkquisition.Subscription{Source: insecure})
+			return nil
+		}))
+		defer func() {
+			require.NoError(t, service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+				settings.Subscriptions = settings.Subscriptions[:2]
+				return nil
+			}))
+		}()
+
+		err := service.RefreshSubscriptions(true)
+		require.ErrorIs(t, err, linkquisition.ErrInsecureSubscription)
+		assert.Contains(t, err.Error(), insecure)
+	})
+
+	t.Run("the rules of the subscriptions are not written to the config-file", func(t *testing.T) {
+		require.NoError(t, service.UpdateSettings(testChange, func(settings *linkquisition.Settings) error {
+			settings.AddRuleToBrowser(&linkquisition.Browser{Name: "Firefox", Command: "firefox %u"}, linkquisition.BrowserMatchTypeSite, "www.example.com")
+			return nil
+		}))
+
+		written, err := os.ReadFile(service.GetConfigFilePath())
+		require.NoError(t, err)
+		assert.NotContains(t, string(written), "corp2.example")
+		assert.NotContains(t, string(written), "local.example")
+		assert.Contains(t, string(written), remote)
+	})
+}
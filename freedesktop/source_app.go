@@ -0,0 +1,146 @@
+package freedesktop
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/strobotti/linkquisition"
+)
+
+const launchedDesktopFileEnv = "GIO_LAUNCHED_DESKTOP_FILE"
+
+// maxProcessDepth guards against walking the process tree forever in case it is (or appears to be) cyclic
+const maxProcessDepth = 32
+
+var _ linkquisition.SourceAppDetector = (*SourceAppDetector)(nil)
+
+// SourceAppDetector finds the application that launched us by walking the process tree in /proc upwards from the
+// parent process
+type SourceAppDetector struct {
+	// ProcFS is the /proc -filesystem to inspect; defaults to the real one
+	ProcFS fs.FS
+
+	// ParentPid is the process to start from; defaults to the parent of the current process
+	ParentPid int
+
+	// LookupEnv looks up the environment of the current process; defaults to os.LookupEnv
+	LookupEnv func(key string) (string, bool)
+}
+
+func (d *SourceAppDetector) DetectSourceApp() (*linkquisition.SourceApp, error) {
+	procFS := d.ProcFS
+	if procFS == nil {
+		procFS = os.DirFS("/proc")
+	}
+
+	pid := d.ParentPid
+	if pid == 0 {
+		pid = os.Getppid()
+	}
+
+	lookupEnv := d.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	app := &linkquisition.SourceApp{}
+
+	// when launched through GIO the variable refers to our own .desktop -file, otherwise it's inherited from the app
+	if desktopFile, isset := lookupEnv(launchedDesktopFileEnv); isset && !isOwnDesktopFile(desktopFile) {
+		app.DesktopFile = desktopFile
+	}
+
+	for depth := 0; pid > 1 && depth < maxProcessDepth; depth++ {
+		process, err := readProcess(procFS, pid)
+		if err != nil {
+			if depth == 0 {
+				return nil, fmt.Errorf("failed to inspect the parent process %d: %v", pid, err)
+			}
+			break
+		}
+
+		app.Processes = append(app.Processes, process.names()...)
+
+		if app.DesktopFile == "" && process.desktopFile != "" && !isOwnDesktopFile(process.desktopFile) {
+			app.DesktopFile = process.desktopFile
+		}
+
+		pid = process.ppid
+	}
+
+	return app, nil
+}
+
+func isOwnDesktopFile(path string) bool {
+	return filepath.Base(path) == "linkquisition.desktop"
+}
+
+type process struct {
+	comm        string
+	command     string
+	ppid        int
+	desktopFile string
+}
+
+// names returns the distinct names of the process: the short name from the kernel and the name of the executable
+func (p *process) names() []string {
+	names := []string{p.comm}
+	if p.command != "" && p.command != p.comm {
+		names = append(names, p.command)
+	}
+
+	return names
+}
+
+func readProcess(procFS fs.FS, pid int) (*process, error) {
+	dir := strconv.Itoa(pid)
+
+	stat, err := fs.ReadFile(procFS, dir+"/stat")
+	if err != nil {
+		return nil, err
+	}
+
+	// the format is `pid (comm) state ppid ...` where comm may contain spaces and parentheses
+	open := bytes.IndexByte(stat, '(')
+	closing := bytes.LastIndexByte(stat, ')')
+	if open < 0 || closing < open {
+		return nil, fmt.Errorf("malformed stat for process %d", pid)
+	}
+
+	fields := strings.Fields(string(stat[closing+1:]))
+	if len(fields) < 2 { //nolint:mnd
+		return nil, fmt.Errorf("malformed stat for process %d", pid)
+	}
+
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed stat for process %d: %v", pid, err)
+	}
+
+	p := &process{
+		comm: string(stat[open+1 : closing]),
+		ppid: ppid,
+	}
+
+	// the rest of the details are nice to have and may well be unreadable for processes of other users
+	if cmdline, cmdErr := fs.ReadFile(procFS, dir+"/cmdline"); cmdErr == nil {
+		if args := bytes.Split(cmdline, []byte{0}); len(args[0]) > 0 {
+			p.command = filepath.Base(string(args[0]))
+		}
+	}
+
+	if environ, envErr := fs.ReadFile(procFS, dir+"/environ"); envErr == nil {
+		for variable := range bytes.SplitSeq(environ, []byte{0}) {
+			if value, found := bytes.CutPrefix(variable, []byte(launchedDesktopFileEnv+"=")); found {
+				p.desktopFile = string(value)
+			}
+		}
+	}
+
+	return p, nil
+}
@@ -0,0 +1,98 @@
+package freedesktop_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition/freedesktop"
+)
+
+func TestSourceAppDetector_DetectSourceApp(t *testing.T) {
+	// signal-desktop (100) -> sh -c xdg-open ... (200) -> xdg-open (300) -> linkquisition
+	procFS := fstest.MapFS{
+		"1/stat":      {Data: []byte("1 (systemd) S 0 1 1 0 -1")},
+		"100/stat":    {Data: []byte("100 (signal-desktop) S 1 100 100 0 -1")},
+		"100/cmdline": {Data: []byte("/opt/Signal/signal-desktop\x00--no-sandbox\x00")},
+		"100/environ": {Data: []byte("HOME=/home/user\x00GIO_LAUNCHED_DESKTOP_FILE=/usr/share/applications/signal-desktop.desktop\x00")},
+		"200/stat":    {Data: []byte("200 (sh) S 100 100 100 0 -1")},
+		"200/cmdline": {Data: []byte("/bin/sh\x00-c\x00xdg-open https://example.com\x00")},
+		"300/stat":    {Data: []byte("300 (xdg-open) S 200 100 100 0 -1")},
+		"300/cmdline": {Data: []byte("/bin/sh\x00/usr/bin/xdg-open\x00https://example.com\x00")},
+	}
+
+	for _, tt := range []struct {
+		name                string
+		env                 map[string]string
+		expectedDesktopFile string
+	}{
+		{
+			name:                "desktop file is read from the ancestors when not set for us",
+			expectedDesktopFile: "/usr/share/applications/signal-desktop.desktop",
+		},
+		{
+			name:                "desktop file of our own is ignored",
+			env:                 map[string]string{"GIO_LAUNCHED_DESKTOP_FILE": "/usr/share/applications/linkquisition.desktop"},
+			expectedDesktopFile: "/usr/share/applications/signal-desktop.desktop",
+		},
+		{
+			name:                "desktop file inherited by us is used",
+			env:                 map[string]string{"GIO_LAUNCHED_DESKTOP_FILE": "/usr/share/applications/teams.desktop"},
+			expectedDesktopFile: "/usr/share/applications/teams.desktop",
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				detector := &SourceAppDetector{
+					ProcFS:    procFS,
+					ParentPid: 300,
+					LookupEnv: func(key string) (string, bool) {
+						value, isset := tt.env[key]
+						return value, isset
+					},
+				}
+
+				app, err := detector.DetectSourceApp()
+				require.NoError(t, err)
+
+				assert.Equal(t, tt.expectedDesktopFile, app.DesktopFile)
+				assert.Equal(t, []string{"xdg-open", "sh", "sh", "signal-desktop"}, app.Processes)
+				assert.True(t, app.Is("signal-desktop"))
+				assert.False(t, app.Is("systemd"))
+			},
+		)
+	}
+}
+
+func TestSourceAppDetector_DetectSourceApp_HandlesOddProcesses(t *testing.T) {
+	procFS := fstest.MapFS{
+		"10/stat": {Data: []byte("10 (Web Content (x)) S 20 10 10 0 -1")},
+		"20/stat": {Data: []byte("20 (loop) S 10 10 10 0 -1")},
+	}
+
+	detector := &SourceAppDetector{
+		ProcFS:    procFS,
+		ParentPid: 10,
+		LookupEnv: func(string) (string, bool) { return "", false },
+	}
+
+	app, err := detector.DetectSourceApp()
+	require.NoError(t, err)
+
+	// the names may contain parentheses and the walk stops even though the processes form a loop
+	assert.Equal(t, "Web Content (x)", app.Processes[0])
+	assert.Len(t, app.Processes, 32)
+}
+
+func TestSourceAppDetector_DetectSourceApp_FailsWithoutParent(t *testing.T) {
+	detector := &SourceAppDetector{
+		ProcFS:    fstest.MapFS{},
+		ParentPid: 10,
+		LookupEnv: func(string) (string, bool) { return "", false },
+	}
+
+	_, err := detector.DetectSourceApp()
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package linkquisition
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var ErrEmptyGlob = errors.New("empty glob pattern")
+
+// hostGlob is a compiled glob-pattern such as `*.corp.example.com` or `*.atlassian.net/wiki/**`
+//
+// The part before the first slash is matched case-insensitively against the host (without the port), where `*` matches
+// any characters. The optional path-part is matched case-sensitively against the path of the URL, where `*` matches
+// anything within a single path segment and `**` matches any number of segments. A pattern without a path matches
+// any path.
+type hostGlob struct {
+	host *regexp.Regexp
+	path *regexp.Regexp
+}
+
+func compileGlob(pattern string) (*hostGlob, error) {
+	if pattern == "" {
+		return nil, ErrEmptyGlob
+	}
+
+	hostPattern, pathPattern, hasPath := strings.Cut(pattern, "/")
+
+	hostRe, err := regexp.Compile("^" + globToRegexp(normalizeHostGlob(hostPattern), ".*") + "$")
+	if err != nil {
+		return nil, err
+	}
+
+	g := &hostGlob{host: hostRe}
+
+	if hasPath {
+		if g.path, err = regexp.Compile("^" + pathGlobToRegexp("/"+pathPattern) + "$"); err != nil {
+			return nil, err
+		}
+	}
+
+	return g, nil
+}
+
+func (g *hostGlob) matches(u *url.URL) bool {
+	if !g.host.MatchString(NormalizeHost(u.Hostname())) {
+		return false
+	}
+
+	return g.path == nil || g.path.MatchString(u.Path)
+}
+
+// normalizeHostGlob brings the labels of the host-part without wildcards to the same form as the hosts they're matched
+// against, so that `*.bücher.de` matches `shop.xn--bcher-kva.de`
+func normalizeHostGlob(pattern string) string {
+	labels := strings.Split(pattern, ".")
+	for i, label := range labels {
+		if strings.Contains(label, "*") {
+			labels[i] = strings.ToLower(label)
+		} else if label != "" {
+			labels[i] = NormalizeHost(label)
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// pathGlobToRegexp converts the path-part of a glob into a regular expression, letting `/**` match the
+// parent folder itself as well as anything below it
+func pathGlobToRegexp(pattern string) string {
+	var sb strings.Builder
+
+	for i, part := range strings.Split(pattern, "/**") {
+		if i > 0 {
+			sb.WriteString("(/.*)?")
+		}
+		sb.WriteString(globToRegexp(part, "[^/]*"))
+	}
+
+	return sb.String()
+}
+
+// globToRegexp quotes everything but the `*` -wildcards, which are replaced with the given expression
+func globToRegexp(pattern, wildcard string) string {
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+
+	return strings.Join(parts, wildcard)
+}
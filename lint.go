@@ -0,0 +1,554 @@
+package linkquisition
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DiagnosticError   = "error"
+	DiagnosticWarning = "warning"
+)
+
+// Diagnostic is a single problem found in a config-file
+type Diagnostic struct {
+	Severity string `json:"severity"`
+
+	// Path is the location of the problem within the JSON document, e.g. `browsers[1].matches[0].value`
+	Path string `json:"path"`
+
+	// Line and Column are the 1-based position of the problem in the config-file
+	Line   int `json:"line"`
+	Column int `json:"column"`
+
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s (%s)", d.Line, d.Column, d.Severity, d.Message, d.Path)
+}
+
+// LintSettings validates the given config-file contents and returns the problems found, in the order they appear
+// in the file. The plugin folders are used for checking that the configured plugins can be found.
+func LintSettings(data []byte, pluginFolderPaths []string) []Diagnostic {
+	l := &linter{data: data, pluginFolderPaths: pluginFolderPaths}
+
+	return l.run(l.lint)
+}
+
+// LintSubscription validates the given file of rules shared through a subscription, see Subscription. Only the
+// top-level rules are used from such a file, and they're checked without the browsers, which are the subscriber's own.
+func LintSubscription(data []byte) []Diagnostic {
+	l := &linter{data: data}
+
+	return l.run(l.lintSubscription)
+}
+
+// run parses the document and lints it with the given function, returning the diagnostics in the order of the document
+func (l *linter) run(lint func(settings *Settings)) []Diagnostic {
+	data := l.data
+
+	var settings Settings
+	unmarshalErr := json.Unmarshal(data, &settings)
+
+	// type errors are located through the index, so it's built for any syntactically valid document
+	var syntaxErr *json.SyntaxError
+	if !errors.As(unmarshalErr, &syntaxErr) {
+		var err error
+		if l.offsets, err = indexJson(data); err != nil {
+			l.reportJsonError(err)
+			return l.diagnostics
+		}
+	}
+
+	if unmarshalErr != nil {
+		l.reportJsonError(unmarshalErr)
+		return l.diagnostics
+	}
+
+	lint(&settings)
+
+	slices.SortStableFunc(l.diagnostics, func(a, b Diagnostic) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+
+	return l.diagnostics
+}
+
+// HasErrors returns true if any of the diagnostics is an error rather than a warning
+func HasErrors(diagnostics []Diagnostic) bool {
+	return slices.ContainsFunc(diagnostics, func(d Diagnostic) bool {
+		return d.Severity == DiagnosticError
+	})
+}
+
+type linter struct {
+	data              []byte
+	offsets           map[string]int64
+	pluginFolderPaths []string
+	diagnostics       []Diagnostic
+}
+
+func (l *linter) lint(settings *Settings) {
+	if settings.Version > SettingsVersion {
+		l.report(
+			DiagnosticError, "version", "the config-file is of version %d, this version of Linkquisition supports up to %d",
+			settings.Version, SettingsVersion,
+		)
+	} else if settings.Version < 0 {
+		l.report(DiagnosticError, "version", "invalid version %d", settings.Version)
+	}
+
+	switch settings.Resolution {
+	case "", ResolutionOrder, ResolutionMostSpecific:
+	default:
+		l.report(DiagnosticError, "resolution", "unknown resolution `%s`", settings.Resolution)
+	}
+
+	commands := map[string]int{}
+
+	for i := range settings.Browsers {
+		browser := &settings.Browsers[i]
+		path := fmt.Sprintf("browsers[%d]", i)
+
+		switch browser.Source {
+		case "", SourceAuto, SourceManual:
+		default:
+			l.report(DiagnosticError, path+".source", "unknown source `%s`, expected `%s` or `%s`", browser.Source, SourceAuto, SourceManual)
+		}
+
+		if !strings.Contains(browser.Command, "%u") && !strings.Contains(browser.Command, "%U") {
+			l.report(DiagnosticError, path+".command", "the command has no `%%u` or `%%U` placeholder for the URL")
+		}
+
+		if first, exists := commands[browser.Command]; exists {
+			l.report(DiagnosticError, path+".command", "the command is the same as for browsers[%d]", first)
+		} else {
+			commands[browser.Command] = i
+		}
+
+		for j := range browser.Matches {
+			l.lintMatch(fmt.Sprintf("%s.matches[%d]", path, j), &browser.Matches[j])
+		}
+	}
+
+	l.lintRules("rules", settings.Rules, settings.Browsers)
+
+	modes := map[string]int{}
+
+	for i := range settings.Modes {
+		path := fmt.Sprintf("modes[%d]", i)
+
+		if settings.Modes[i].Name == "" {
+			l.report(DiagnosticError, path, "the mode has no name")
+		} else if first, exists := modes[settings.Modes[i].Name]; exists {
+			l.report(DiagnosticError, path+".name", "the name is the same as for modes[%d]", first)
+		} else {
+			modes[settings.Modes[i].Name] = i
+		}
+
+		l.lintRules(path+".rules", settings.Modes[i].Rules, settings.Browsers)
+	}
+
+	if _, exists := modes[settings.ActiveMode]; settings.ActiveMode != "" && !exists {
+		l.report(DiagnosticError, "activeMode", "no mode named `%s`", settings.ActiveMode)
+	}
+
+	l.lintShadowedRules(settings)
+
+	for i := range settings.Subscriptions {
+		subscription := &settings.Subscriptions[i]
+		path := fmt.Sprintf("subscriptions[%d]", i)
+
+		if subscription.Source == "" {
+			l.report(DiagnosticError, path, "the subscription has no source")
+		} else if err := subscription.Validate(); errors.Is(err, ErrInsecureSubscription) {
+			l.report(DiagnosticError, path+".source", "the URL has to use https")
+		} else if errors.Is(err, ErrRelativeSubscription) {
+			l.report(DiagnosticError, path+".source", "the path `%s` has to be absolute", subscription.Source)
+		}
+
+		if interval, err := time.ParseDuration(subscription.Refresh); subscription.Refresh != "" && (err != nil || interval <= 0) {
+			l.report(DiagnosticError, path+".refresh", "invalid refresh interval `%s`, expected a duration such as `1h`", subscription.Refresh)
+		}
+	}
+
+	for i := range settings.Plugins {
+		if _, found := ResolvePluginPath(settings.Plugins[i].Path, l.pluginFolderPaths); !found {
+			l.report(
+				DiagnosticError, fmt.Sprintf("plugins[%d].path", i),
+				"plugin `%s` not found in %s", settings.Plugins[i].Path, strings.Join(l.pluginFolderPaths, ", "),
+			)
+		}
+	}
+}
+
+func (l *linter) lintRules(path string, rules []Rule, browsers []BrowserSettings) {
+	for i := range rules {
+		rulePath := fmt.Sprintf("%s[%d]", path, i)
+
+		if _, err := resolveRuleBrowser(&rules[i], browsers); errors.Is(err, ErrUnknownAction) {
+			l.report(DiagnosticError, rulePath+".action", "unknown action `%s`", rules[i].Action)
+		} else if errors.Is(err, ErrUnknownRole) {
+			l.report(DiagnosticError, rulePath+".role", "no browser has the role `%s`", rules[i].Role)
+		} else if err != nil {
+			l.report(DiagnosticError, rulePath+".browser", "no browser named `%s`", rules[i].Browser)
+		}
+
+		l.lintMatch(rulePath, &rules[i].BrowserMatch)
+	}
+}
+
+// lintSubscription lints a file of shared rules: a rule can only open the URL, without rewriting it or overriding the
+// subscriber's own rules, as it would apply to every subscriber's links
+func (l *linter) lintSubscription(settings *Settings) {
+	for i := range settings.Rules {
+		rule := &settings.Rules[i]
+		path := fmt.Sprintf("rules[%d]", i)
+
+		if _, err := resolveRuleBrowser(rule, nil); errors.Is(err, ErrUnknownAction) {
+			l.report(DiagnosticError, path+".action", "unknown action `%s`", rule.Action)
+		} else if rule.Action != RuleActionOpen {
+			l.report(DiagnosticError, path+".action", "a subscribed rule can only open the URL; the rule is ignored")
+		}
+
+		if rule.Rewrite != nil {
+			l.report(DiagnosticError, path+".rewrite", "a subscribed rule can't rewrite the URL; the rewrite is ignored")
+		}
+		if rule.Priority != 0 {
+			l.report(DiagnosticWarning, path+".priority", "a subscribed rule has no priority; the priority is ignored")
+		}
+
+		l.lintMatch(path, &rule.BrowserMatch)
+	}
+}
+
+func (l *linter) lintMatch(path string, match *BrowserMatch) {
+	if match.Type == "" && len(match.All) == 0 {
+		l.report(DiagnosticError, path, "the rule has neither a type nor any conditions in `all`")
+	}
+
+	if match.Type != "" {
+		if _, err := compileCondition(*match); errors.Is(err, ErrUnknownMatchType) {
+			l.report(DiagnosticError, path+".type", "unknown match type `%s`", match.Type)
+		} else if errors.Is(err, ErrUnknownPublicSuffixes) {
+			l.report(
+				DiagnosticError, path+".publicSuffixes", "unknown public suffixes `%s`, expected `%s` or `%s`",
+				match.PublicSuffixes, PublicSuffixesPrivate, PublicSuffixesIcann,
+			)
+		} else if err != nil {
+			l.report(DiagnosticError, path+".value", "invalid %s `%s`: %v", match.Type, match.Value, err)
+		}
+	}
+
+	if match.PublicSuffixes != "" && match.Type != BrowserMatchTypeDomain {
+		l.report(DiagnosticWarning, path+".publicSuffixes", "publicSuffixes only applies to domain-rules")
+	}
+
+	if match.When != nil {
+		if _, err := compileSchedule(match.When); err != nil {
+			l.report(DiagnosticError, path+".when", "invalid schedule: %v", err)
+		}
+	}
+
+	if match.Rewrite != nil {
+		if _, err := compileRewrite(match.Rewrite); err != nil {
+			l.report(DiagnosticError, path+".rewrite", "invalid %v", err)
+		}
+	}
+
+	if match.IsExpired(time.Now()) {
+		l.report(DiagnosticWarning, path+".expiresAt", "the rule expired at %s", match.ExpiresAt.Format(time.RFC3339))
+	}
+
+	for i := range match.All {
+		l.lintMatch(fmt.Sprintf("%s.all[%d]", path, i), &match.All[i])
+	}
+
+	for i := range match.Not {
+		l.lintMatch(fmt.Sprintf("%s.not[%d]", path, i), &match.Not[i])
+	}
+}
+
+// lintShadowedRules reports the rules which can never fire because a top-level rule or a rule of an earlier browser
+// matches all the same URLs (and more). Only the obvious cases are detected: identical rules, and sites or paths within
+// an earlier domain.
+func (l *linter) lintShadowedRules(settings *Settings) {
+	mostSpecific := settings.Resolution == ResolutionMostSpecific
+
+	topLevel := make([]BrowserMatch, len(settings.Rules))
+	for i := range settings.Rules {
+		topLevel[i] = settings.Rules[i].BrowserMatch
+	}
+
+	for j := range settings.Browsers {
+		for k := range settings.Browsers[j].Matches {
+			rule := &settings.Browsers[j].Matches[k]
+
+			if shadow := findShadowingRule(topLevel, rule, mostSpecific); shadow >= 0 {
+				l.report(
+					DiagnosticWarning, fmt.Sprintf("browsers[%d].matches[%d]", j, k),
+					"the rule never fires as rules[%d] (%s) matches first", shadow, settings.Rules[shadow].Action,
+				)
+				continue
+			}
+
+			for i := 0; i < j; i++ {
+				if shadow := findShadowingRule(settings.Browsers[i].Matches, rule, mostSpecific); shadow >= 0 {
+					l.report(
+						DiagnosticWarning, fmt.Sprintf("browsers[%d].matches[%d]", j, k),
+						"the rule never fires as browsers[%d].matches[%d] (%s) matches first",
+						i, shadow, settings.Browsers[i].Name,
+					)
+					break
+				}
+			}
+		}
+	}
+}
+
+func findShadowingRule(candidates []BrowserMatch, rule *BrowserMatch, mostSpecific bool) int {
+	for i := range candidates {
+		shadow := &candidates[i]
+
+		// only unconditional rules are sure to match whenever the shadowed rule does
+		if !shadow.isPlain() || shadow.Priority < rule.Priority {
+			continue
+		}
+
+		if mostSpecific && shadow.Priority == rule.Priority && shadow.Specificity() < rule.Specificity() {
+			continue
+		}
+
+		if covers(shadow, rule) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// covers returns true if every URL matched by the rule is also matched by the shadow
+func covers(shadow, rule *BrowserMatch) bool {
+	if shadow.Type == rule.Type && shadow.PublicSuffixes == rule.PublicSuffixes &&
+		(strings.EqualFold(shadow.Value, rule.Value) || sameHostRule(shadow, rule)) {
+		return true
+	}
+
+	if shadow.Type == BrowserMatchTypeHostSuffix && rule.Type == BrowserMatchTypeHostSuffix {
+		return withinHostSuffix(shadow.Value, rule.Value)
+	}
+
+	host := ruleHost(rule)
+	if host == "" {
+		return false
+	}
+
+	switch shadow.Type {
+	case BrowserMatchTypeSite:
+		return rule.Type != BrowserMatchTypeSite && normalizeSite(shadow.Value) == normalizeSite(host)
+	case BrowserMatchTypeDomain:
+		u := NewURL("//" + host)
+		domain, err := u.GetDomain()
+		if shadow.PublicSuffixes == PublicSuffixesIcann {
+			domain, err = u.GetIcannDomain()
+		}
+		return err == nil && NormalizeHost(shadow.Value) == domain
+	case BrowserMatchTypeHostSuffix:
+		hostname, err := NewURL("//" + host).GetHost()
+		return err == nil && withinHostSuffix(shadow.Value, hostname)
+	}
+
+	return false
+}
+
+// sameHostRule returns true for host-based rules naming the same host in different forms, e.g. in Unicode and in
+// punycode
+func sameHostRule(a, b *BrowserMatch) bool {
+	switch a.Type {
+	case BrowserMatchTypeSite:
+		return normalizeSite(a.Value) == normalizeSite(b.Value)
+	case BrowserMatchTypeDomain:
+		return NormalizeHost(a.Value) == NormalizeHost(b.Value)
+	case BrowserMatchTypeHostSuffix:
+		return withinHostSuffix(a.Value, b.Value) && withinHostSuffix(b.Value, a.Value)
+	}
+
+	return false
+}
+
+// withinHostSuffix returns true if the host is the given suffix or one of its subdomains
+func withinHostSuffix(suffix, host string) bool {
+	suffix = NormalizeHost(strings.TrimPrefix(suffix, "."))
+	host = NormalizeHost(strings.TrimPrefix(host, "."))
+
+	return host == suffix || strings.HasSuffix(host, "."+suffix)
+}
+
+// ruleHost returns the exact host a rule is limited to, if any
+func ruleHost(rule *BrowserMatch) string {
+	switch rule.Type {
+	case BrowserMatchTypeSite:
+		return rule.Value
+	case BrowserMatchTypePathPrefix:
+		host, _, _ := strings.Cut(rule.Value, "/")
+		return host
+	case BrowserMatchTypeQuery:
+		host, _, found := strings.Cut(rule.Value, "?")
+		if found {
+			return host
+		}
+	}
+
+	return ""
+}
+
+func (l *linter) report(severity, path, format string, args ...any) {
+	line, column := l.position(path)
+
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Severity: severity,
+		Path:     path,
+		Line:     line,
+		Column:   column,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// position returns the line and column of the given path, or of its closest parent present in the file
+func (l *linter) position(path string) (line, column int) {
+	for {
+		if offset, found := l.offsets[path]; found {
+			return offsetToPosition(l.data, offset)
+		}
+
+		cut := strings.LastIndexAny(path, ".[")
+		if cut < 0 {
+			return offsetToPosition(l.data, 0)
+		}
+		path = path[:cut]
+	}
+}
+
+func (l *linter) reportJsonError(err error) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		// the offset is right after the offending character
+		line, column := offsetToPosition(l.data, max(syntaxErr.Offset-1, 0))
+		l.diagnostics = append(l.diagnostics, Diagnostic{
+			Severity: DiagnosticError,
+			Line:     line,
+			Column:   column,
+			Message:  syntaxErr.Error(),
+		})
+	case errors.As(err, &typeErr):
+		path := jsonFieldToPath(typeErr.Field)
+		l.report(DiagnosticError, path, "expected a value of type %s, got %s", typeErr.Type, typeErr.Value)
+	default:
+		l.report(DiagnosticError, "", "%v", err)
+	}
+}
+
+// jsonFieldToPath converts the dotted field of an UnmarshalTypeError, e.g. `browsers.0.name`, to `browsers[0].name`
+func jsonFieldToPath(field string) string {
+	var path strings.Builder
+
+	for part := range strings.SplitSeq(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil {
+			path.WriteString("[" + part + "]")
+			continue
+		}
+
+		if path.Len() > 0 {
+			path.WriteString(".")
+		}
+		path.WriteString(part)
+	}
+
+	return path.String()
+}
+
+func offsetToPosition(data []byte, offset int64) (line, column int) {
+	offset = min(offset, int64(len(data)))
+	before := data[:offset]
+
+	line = bytes.Count(before, []byte{'\n'}) + 1
+	column = int(offset) - bytes.LastIndexByte(before, '\n')
+
+	return line, column
+}
+
+// indexJson returns the offsets of all the values in the JSON document by their paths, e.g. `browsers[1].command`
+func indexJson(data []byte) (map[string]int64, error) {
+	ix := &jsonIndexer{
+		data:    data,
+		decoder: json.NewDecoder(bytes.NewReader(data)),
+		offsets: map[string]int64{},
+	}
+
+	return ix.offsets, ix.walk("")
+}
+
+type jsonIndexer struct {
+	data    []byte
+	decoder *json.Decoder
+	offsets map[string]int64
+}
+
+func (ix *jsonIndexer) walk(path string) error {
+	// the decoder is positioned right after the previous token, so skip over the separators to the start of the value
+	offset := ix.decoder.InputOffset()
+	for offset < int64(len(ix.data)) && bytes.IndexByte([]byte(" \t\r\n,:"), ix.data[offset]) >= 0 {
+		offset++
+	}
+	ix.offsets[path] = offset
+
+	token, err := ix.decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		for ix.decoder.More() {
+			key, keyErr := ix.decoder.Token()
+			if keyErr != nil {
+				return keyErr
+			}
+
+			childPath := fmt.Sprint(key)
+			if path != "" {
+				childPath = path + "." + childPath
+			}
+
+			if err = ix.walk(childPath); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for i := 0; ix.decoder.More(); i++ {
+			if err = ix.walk(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	// the closing delimiter
+	_, err = ix.decoder.Token()
+
+	return err
+}
@@ -0,0 +1,239 @@
+package linkquisition_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestLintSettings(t *testing.T) {
+	for _, tt := range [...]struct {
+		name     string
+		config   string
+		expected []Diagnostic
+	}{
+		{
+			name: "a valid config has no diagnostics",
+			config: `{
+  "browsers": [
+    {"name": "Firefox", "command": "firefox %u", "source": "auto", "matches": [{"type": "site", "value": "example.com"}]}
+  ]
+}`,
+			expected: nil,
+		},
+		{
+			name:   "syntax errors are reported at their position",
+			config: "{\n  \"browsers\": [\n    {\"name\": \"Firefox\",}\n  ]\n}",
+			expected: []Diagnostic{
+				{Severity: DiagnosticError, Line: 3, Column: 24, Message: "invalid character '}' looking for beginning of object key string"},
+			},
+		},
+		{
+			name:   "type errors are reported at their position",
+			config: "{\n  \"browsers\": [\n    {\"name\": 1}\n  ]\n}",
+			expected: []Diagnostic{
+				{Severity: DiagnosticError, Path: "browsers[0].name", Line: 3, Column: 14, Message: "expected a value of type string, got number"},
+			},
+		},
+		{
+			name: "invalid rules, sources and commands are reported",
+			config: `{
+  "browsers": [
+    {
+      "name": "Firefox",
+      "command": "firefox",
+      "source": "automatic",
+      "matches": [
+        {"type": "regex", "value": "(unclosed"},
+        {"type": "website", "value": "example.com"},
+        {"all": [{"type": "glob", "value": ""}]},
+        {"type": "site", "value": "vendor.example.com", "expiresAt": "2020-01-01T00:00:00Z"}
+      ]
+    }
+  ]
+}`,
+			expected: []Diagnostic{
+				{Severity: DiagnosticError, Path: "browsers[0].command", Line: 5, Column: 18, Message: "the command has no `%u` or `%U` placeholder for the URL"},
+				{Severity: DiagnosticError, Path: "browsers[0].source", Line: 6, Column: 17, Message: "unknown source `automatic`, expected `auto` or `manual`"},
+				{Severity: DiagnosticError, Path: "browsers[0].matches[0].value", Line: 8, Column: 36, Message: "invalid regex `(unclosed`: error parsing regexp: missing closing ): `(unclosed`"},
+				{Severity: DiagnosticError, Path: "browsers[0].matches[1].type", Line: 9, Column: 18, Message: "unknown match type `website`"},
+				{Severity: DiagnosticError, Path: "browsers[0].matches[2].all[0].value", Line: 10, Column: 44, Message: "invalid glob ``: empty glob pattern"},
+				{Severity: DiagnosticWarning, Path: "browsers[0].matches[3].expiresAt", Line: 11, Column: 70, Message: "the rule expired at 2020-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name: "duplicate commands and shadowed rules are reported",
+			config: `{
+  "browsers": [
+    {"name": "Firefox", "command": "firefox %u", "matches": [{"type": "domain", "value": "example.com"}]},
+    {"name": "Firefox again", "command": "firefox %u"},
+    {
+      "name": "Chrome",
+      "command": "chrome %U",
+      "matches": [
+        {"type": "site", "value": "www.example.com"},
+        {"type": "pathPrefix", "value": "example.com/docs"},
+        {"type": "site", "value": "www.example.com", "priority": 1},
+        {"type": "site", "value": "www.example.org"}
+      ]
+    }
+  ]
+}`,
+			expected: []Diagnostic{
+				{Severity: DiagnosticError, Path: "browsers[1].command", Line: 4, Column: 42, Message: "the command is the same as for browsers[0]"},
+				{Severity: DiagnosticWarning, Path: "browsers[2].matches[0]", Line: 9, Column: 9, Message: "the rule never fires as browsers[0].matches[0] (Firefox) matches first"},
+				{Severity: DiagnosticWarning, Path: "browsers[2].matches[1]", Line: 10, Column: 9, Message: "the rule never fires as browsers[0].matches[0] (Firefox) matches first"},
+			},
+		},
+		{
+			name: "only identical rules shadow each other when the most specific rule wins",
+			config: `{
+  "resolution": "mostSpecific",
+  "browsers": [
+    {"name": "Firefox", "command": "firefox %u", "matches": [{"type": "domain", "value": "example.com"}]},
+    {"name": "Chrome", "command": "chrome %U", "matches": [{"type": "site", "value": "www.example.com"}, {"type": "domain", "value": "example.com"}]}
+  ]
+}`,
+			expected: []Diagnostic{
+				{Severity: DiagnosticWarning, Path: "browsers[1].matches[1]", Line: 5, Column: 106, Message: "the rule never fires as browsers[0].matches[0] (Firefox) matches first"},
+			},
+		},
+		{
+			name: "top-level rules are checked as well",
+			config: `{
+  "browsers": [
+    {"name": "Firefox", "command": "firefox %u", "matches": [{"type": "site", "value": "ads.tracker.example"}]}
+  ],
+  "rules": [
+    {"type": "domain", "value": "tracker.example", "action": "block"},
+    {"type": "site", "value": "www.example.com", "action": "launch"},
+    {"type": "site", "value": "www.example.org", "action": "open", "browser": "Opera"}
+  ]
+}`,
+			expected: []Diagnostic{
+				{Severity: DiagnosticWarning, Path: "browsers[0].matches[0]", Line: 3, Column: 62, Message: "the rule never fires as rules[0] (block) matches first"},
+				{Severity: DiagnosticError, Path: "rules[1].action", Line: 7, Column: 60, Message: "unknown action `launch`"},
+				{Severity: DiagnosticError, Path: "rules[2].browser", Line: 8, Column: 79, Message: "no browser named `Opera`"},
+			},
+		},
+		{
+			name: "modes are checked",
+			config: `{
+  "browsers": [{"name": "Firefox", "command": "firefox %u"}],
+  "modes": [
+    {"name": "client-a", "rules": [{"type": "domain", "value": "client-a.com", "action": "open", "browser": "Chrome"}]},
+    {"name": "client-a"}
+  ],
+  "activeMode": "client-b"
+}`,
+			expected: []Diagnostic{
+				{Severity: DiagnosticError, Path: "modes[0].rules[0].browser", Line: 4, Column: 109, Message: "no browser named `Chrome`"},
+				{Severity: DiagnosticError, Path: "modes[1].name", Line: 5, Column: 14, Message: "the name is the same as for modes[0]"},
+				{Severity: DiagnosticError, Path: "activeMode", Line: 7, Column: 17, Message: "no mode named `client-b`"},
+			},
+		},
+		{
+			name: "host suffixes and public suffixes are checked",
+			config: `{
+  "browsers": [
+    {"name": "Firefox", "command": "firefox %u", "matches": [{"type": "hostSuffix", "value": "corp.example.com"}]},
+    {
+      "name": "Chrome",
+      "command": "chrome %U",
+      "matches": [
+        {"type": "site", "value": "wiki.corp.example.com"},
+        {"type": "domain", "value": "github.io", "publicSuffixes": "all"},
+        {"type": "site", "value": "example.com", "publicSuffixes": "icann"}
+      ]
+    }
+  ]
+}`,
+			expected: []Diagnostic{
+				{Severity: DiagnosticWarning, Path: "browsers[1].matches[0]", Line: 8, Column: 9, Message: "the rule never fires as browsers[0].matches[0] (Firefox) matches first"},
+				{Severity: DiagnosticError, Path: "browsers[1].matches[1].publicSuffixes", Line: 9, Column: 68, Message: "unknown public suffixes `all`, expected `private` or `icann`"},
+				{Severity: DiagnosticWarning, Path: "browsers[1].matches[2].publicSuffixes", Line: 10, Column: 68, Message: "publicSuffixes only applies to domain-rules"},
+			},
+		},
+		{
+			name: "unknown roles and invalid subscriptions are reported",
+			config: `{
+  "browsers": [{"name": "Firefox", "command": "firefox %u", "roles": ["work"], "matches": []}],
+  "rules": [
+    {"type": "site", "value": "intranet.example.com", "action": "open", "role": "work"},
+    {"type": "site", "value": "example.com", "action": "open", "role": "personal"}
+  ],
+  "subscriptions": [{"source": "https://example.com/rules.json", "refresh": "daily"}, {"source": ""}, {"source": "http://example.com/rules.json"}, {"source": "team/rules.json"}]
+}`,
+			expected: []Diagnostic{
+				{Severity: DiagnosticError, Path: "rules[1].role", Line: 5, Column: 72, Message: "no browser has the role `personal`"},
+				{Severity: DiagnosticError, Path: "subscriptions[0].refresh", Line: 7, Column: 77, Message: "invalid refresh interval `daily`, expected a duration such as `1h`"},
+				{Severity: DiagnosticError, Path: "subscriptions[1]", Line: 7, Column: 87, Message: "the subscription has no source"},
+				{Severity: DiagnosticError, Path: "subscriptions[2].source", Line: 7, Column: 114, Message: "the URL has to use https"},
+				{Severity: DiagnosticError, Path: "subscriptions[3].source", Line: 7, Column: 159, Message: "the path `team/rules.json` has to be absolute"},
+			},
+		},
+		{
+			name: "rules with conditions do not shadow others",
+			config: `{
+  "browsers": [
+    {"name": "Firefox", "command": "firefox %u", "matches": [{"type": "domain", "value": "example.com", "not": [{"type": "site", "value": "www.example.com"}]}]},
+    {"name": "Chrome", "command": "chrome %U", "matches": [{"type": "site", "value": "www.example.com"}]}
+  ]
+}`,
+			expected: nil,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				assert.Equal(t, tt.expected, LintSettings([]byte(tt.config), nil))
+			},
+		)
+	}
+}
+
+func TestLintSettings_Plugins(t *testing.T) {
+	pluginFolder := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(pluginFolder, "unwrap.so"), nil, 0600))
+
+	config := `{
+  "plugins": [
+    {"path": "unwrap"},
+    {"path": "missing.so"}
+  ]
+}`
+
+	diagnostics := LintSettings([]byte(config), []string{pluginFolder})
+
+	require.Len(t, diagnostics, 1)
+	assert.Equal(t, "plugins[1].path", diagnostics[0].Path)
+	assert.Equal(t, 4, diagnostics[0].Line)
+	assert.True(t, HasErrors(diagnostics))
+}
+
+func TestLintSubscription(t *testing.T) {
+	config := `{
+  "rules": [
+    {"type": "domain", "value": "corp.example", "action": "open", "role": "work"},
+    {"type": "domain", "value": "example.com", "action": "open", "role": "work", "rewrite": {"scheme": "http"}},
+    {"type": "site", "value": "www.example.org", "action": "launch"},
+    {"type": "domain", "value": "tracker.example", "action": "block"},
+    {"type": "site", "value": "wiki.corp.example", "action": "open", "role": "work", "priority": 10}
+  ]
+}`
+
+	assert.Equal(
+		t,
+		[]Diagnostic{
+			{Severity: DiagnosticError, Path: "rules[1].rewrite", Line: 4, Column: 93, Message: "a subscribed rule can't rewrite the URL; the rewrite is ignored"},
+			{Severity: DiagnosticError, Path: "rules[2].action", Line: 5, Column: 60, Message: "unknown action `launch`"},
+			{Severity: DiagnosticError, Path: "rules[3].action", Line: 6, Column: 62, Message: "a subscribed rule can only open the URL; the rule is ignored"},
+			{Severity: DiagnosticWarning, Path: "rules[4].priority", Line: 7, Column: 98, Message: "a subscribed rule has no priority; the priority is ignored"},
+		},
+		LintSubscription([]byte(config)),
+	)
+}
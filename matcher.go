@@ -0,0 +1,740 @@
+package linkquisition
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RuleError describes a browser-rule, or a top-level rule, that could not be compiled
+type RuleError struct {
+	// Browser is the name of the browser the rule belongs to; empty for the top-level rules
+	Browser string
+
+	// Mode is the name of the mode the top-level rule belongs to; empty for the global rules
+	Mode string
+
+	RuleIndex int
+	Rule      BrowserMatch
+	Err       error
+}
+
+func (e *RuleError) Error() string {
+	if e.Mode != "" {
+		return fmt.Sprintf("mode `%s` rule #%d (%s `%s`): %v", e.Mode, e.RuleIndex, e.Rule.Type, e.Rule.Value, e.Err)
+	}
+
+	if e.Browser == "" {
+		return fmt.Sprintf("rule #%d (%s `%s`): %v", e.RuleIndex, e.Rule.Type, e.Rule.Value, e.Err)
+	}
+
+	return fmt.Sprintf("browser `%s` rule #%d (%s `%s`): %v", e.Browser, e.RuleIndex, e.Rule.Type, e.Rule.Value, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+var ErrUnknownMatchType = errors.New("unknown match type")
+var ErrEmptyRule = errors.New("rule has neither a type nor any conditions in `all`")
+var ErrUnknownAction = errors.New("unknown action")
+var ErrUnknownBrowser = errors.New("unknown browser")
+var ErrUnknownMode = errors.New("unknown mode")
+var ErrUnknownRole = errors.New("no browser has the role")
+var ErrUnknownPublicSuffixes = errors.New("unknown public suffixes")
+var ErrEmptyHostSuffix = errors.New("empty host suffix")
+
+// MatchResult describes the rule that matched a URL and what is to be done with the URL
+type MatchResult struct {
+	// Url is the URL to act on, rewritten if the rule has a rewrite
+	Url string
+
+	// Action is RuleActionOpen for the browser-rules and the action of the rule for the top-level rules
+	Action string
+
+	// Browser is the browser to open the URL with; only set for RuleActionOpen
+	Browser      Browser
+	BrowserIndex int
+
+	// RuleIndex is the index of the rule within the browser, or within the top-level rules if TopLevelRule is set
+	RuleIndex    int
+	Rule         BrowserMatch
+	TopLevelRule *Rule
+
+	// Mode is the name of the mode the top-level rule belongs to; empty for the global rules
+	Mode string
+}
+
+// The pseudo browser-indices of the top-level rules. Being negative they come before the browser-rules in the order of
+// the settings, the rules of the active mode first.
+const (
+	modeRulesIndex   = -2
+	globalRulesIndex = -1
+)
+
+// ruleRef points to a single rule of a single browser in the compiled settings
+type ruleRef struct {
+	browser     int
+	rule        int
+	priority    int
+	specificity int
+	locked      bool
+	subscribed  bool
+}
+
+// ruleKey identifies a rule regardless of how it's resolved
+type ruleKey struct {
+	browser int
+	rule    int
+}
+
+// matchInput holds the URL being matched in the forms needed by the different rule types
+type matchInput struct {
+	raw    string
+	parsed *url.URL
+	site   string
+	domain string
+	now    time.Time
+	env    *MatchEnvironment
+
+	// sitePort is the site with the port, if the URL has one
+	sitePort string
+
+	// icannDomain is the domain of the URL derived using only the ICANN public suffixes
+	icannDomain string
+
+	network *networkState
+}
+
+// getNetwork probes the network on the first call, so that only the URLs matched against network-conditions pay for it
+func (in *matchInput) getNetwork() *networkState {
+	if in.network == nil {
+		in.network = probeNetwork(in.env.Network)
+	}
+
+	return in.network
+}
+
+func newMatchInput(u string, env *MatchEnvironment) *matchInput {
+	uu := NewURL(u)
+	in := &matchInput{raw: u, now: env.now(), env: env}
+
+	if parsed, err := url.Parse(u); err == nil {
+		in.parsed = parsed
+	}
+	if site, err := uu.GetSite(); err == nil {
+		in.site = site
+	}
+	if port := uu.GetPort(); in.site != "" && port != "" {
+		in.sitePort = net.JoinHostPort(in.site, port)
+	}
+	if domain, err := uu.GetDomain(); err == nil {
+		in.domain = domain
+	}
+	if domain, err := uu.GetIcannDomain(); err == nil {
+		in.icannDomain = domain
+	}
+
+	return in
+}
+
+// condition is a compiled rule which has to be evaluated against every URL
+type condition func(in *matchInput) bool
+
+type compiledRule struct {
+	ref       ruleRef
+	condition condition
+}
+
+// Matcher is the compiled form of the browser-rules in Settings. It is built once and can then be used for any number
+// of lookups: site and domain rules are kept in hash lookups and the other rule types are compiled only once.
+type Matcher struct {
+	browsers     []BrowserSettings
+	rules        []Rule
+	mode         *Mode
+	env          *MatchEnvironment
+	mostSpecific bool
+
+	// exhaustive is set when the first matching rule in the order of the settings isn't necessarily the best one
+	exhaustive bool
+
+	// ruleBrowsers holds the index of the browser for each top-level rule with RuleActionOpen
+	ruleBrowsers map[ruleKey]int
+
+	// rewrites holds the compiled URL rewrites of the rules having one
+	rewrites map[ruleRef]*compiledRewrite
+
+	sites    map[string][]ruleRef
+	domains  map[string][]ruleRef
+	compiled []compiledRule
+}
+
+// matcherSource identifies the settings a Matcher was compiled from by the slices of the rules rather than by their
+// contents, which is enough for telling whether the rules have been replaced, added or removed since
+type matcherSource struct {
+	browsers   []BrowserSettings
+	matches    [][]BrowserMatch
+	rules      []Rule
+	modes      []Mode
+	modeRules  []Rule
+	activeMode string
+	resolution string
+}
+
+func newMatcherSource(settings *Settings) matcherSource {
+	source := matcherSource{
+		browsers:   settings.Browsers,
+		matches:    make([][]BrowserMatch, len(settings.Browsers)),
+		rules:      settings.Rules,
+		modes:      settings.Modes,
+		activeMode: settings.ActiveMode,
+		resolution: settings.Resolution,
+	}
+
+	for i := range settings.Browsers {
+		source.matches[i] = settings.Browsers[i].Matches
+	}
+	if mode := settings.GetActiveMode(); mode != nil {
+		source.modeRules = mode.Rules
+	}
+
+	return source
+}
+
+func (s *matcherSource) isSame(other *matcherSource) bool {
+	if !isSameSlice(s.browsers, other.browsers) || !isSameSlice(s.rules, other.rules) || !isSameSlice(s.modes, other.modes) ||
+		!isSameSlice(s.modeRules, other.modeRules) || s.activeMode != other.activeMode || s.resolution != other.resolution {
+		return false
+	}
+
+	for i := range s.matches {
+		if !isSameSlice(s.matches[i], other.matches[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isSameSlice returns true if the slices are one and the same, i.e. of the same length and backed by the same array
+func isSameSlice[T any](a, b []T) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// NewMatcher compiles the browser-rules, the global rules and the rules of the active mode of the given settings.
+// Rules that fail to compile are left out of the matcher and reported as RuleErrors joined into the returned error;
+// the matcher is usable regardless.
+func NewMatcher(settings *Settings) (*Matcher, error) {
+	m := &Matcher{
+		browsers:     settings.Browsers,
+		rules:        settings.Rules,
+		env:          &settings.Environment,
+		mostSpecific: settings.Resolution == ResolutionMostSpecific,
+		ruleBrowsers: map[ruleKey]int{},
+		rewrites:     map[ruleRef]*compiledRewrite{},
+		sites:        map[string][]ruleRef{},
+		domains:      map[string][]ruleRef{},
+	}
+	m.exhaustive = m.mostSpecific
+
+	var errs []error
+
+	if settings.ActiveMode != "" {
+		if m.mode = settings.GetActiveMode(); m.mode == nil {
+			errs = append(errs, fmt.Errorf("%w `%s`", ErrUnknownMode, settings.ActiveMode))
+		} else {
+			errs = append(errs, m.addTopLevelRules(modeRulesIndex, m.mode.Rules, m.mode.Name)...)
+		}
+	}
+
+	errs = append(errs, m.addTopLevelRules(globalRulesIndex, settings.Rules, "")...)
+
+	for i := range settings.Browsers {
+		for j, match := range settings.Browsers[i].Matches {
+			if err := m.add(ruleRef{browser: i, rule: j}, match); err != nil {
+				errs = append(errs, &RuleError{Browser: settings.Browsers[i].Name, RuleIndex: j, Rule: match, Err: err})
+			}
+		}
+	}
+
+	return m, errors.Join(errs...)
+}
+
+func (m *Matcher) addTopLevelRules(index int, rules []Rule, mode string) []error {
+	var errs []error
+
+	for i := range rules {
+		rule := &rules[i]
+
+		browserIndex, err := resolveRuleBrowser(rule, m.browsers)
+		if err != nil {
+			errs = append(errs, &RuleError{Mode: mode, RuleIndex: i, Rule: rule.BrowserMatch, Err: err})
+			continue
+		}
+		if browserIndex >= 0 {
+			m.ruleBrowsers[ruleKey{browser: index, rule: i}] = browserIndex
+		}
+
+		if err := m.add(ruleRef{browser: index, rule: i}, rule.BrowserMatch); err != nil {
+			errs = append(errs, &RuleError{Mode: mode, RuleIndex: i, Rule: rule.BrowserMatch, Err: err})
+		}
+	}
+
+	return errs
+}
+
+// resolveRuleBrowser validates the action of a top-level rule and returns the index of the browser the rule opens the
+// URLs with, or -1 if the action doesn't involve a browser
+func resolveRuleBrowser(rule *Rule, browsers []BrowserSettings) (int, error) {
+	switch rule.Action {
+	case RuleActionOpen:
+		if rule.Browser == "" && rule.Role != "" {
+			for i := range browsers {
+				if slices.Contains(browsers[i].Roles, rule.Role) {
+					return i, nil
+				}
+			}
+			return -1, fmt.Errorf("%w `%s`", ErrUnknownRole, rule.Role)
+		}
+		for i := range browsers {
+			if browsers[i].Name == rule.Browser || browsers[i].Command == rule.Browser {
+				return i, nil
+			}
+		}
+		return -1, fmt.Errorf("%w `%s`", ErrUnknownBrowser, rule.Browser)
+	case RuleActionBlock, RuleActionAsk, RuleActionCopy, RuleActionSystemDefault:
+		return -1, nil
+	default:
+		return -1, fmt.Errorf("%w `%s`", ErrUnknownAction, rule.Action)
+	}
+}
+
+// add compiles the given rule into the matcher
+func (m *Matcher) add(ref ruleRef, match BrowserMatch) error {
+	ref.priority = match.Priority
+	ref.specificity = match.Specificity()
+	ref.locked = match.Locked
+	ref.subscribed = match.Subscribed
+	if match.Priority != 0 || match.Locked || match.Subscribed {
+		m.exhaustive = true
+	}
+
+	if match.Rewrite != nil {
+		rewrite, err := compileRewrite(match.Rewrite)
+		if err != nil {
+			return err
+		}
+		m.rewrites[ref] = rewrite
+	}
+
+	switch {
+	case match.isPlain() && match.Type == BrowserMatchTypeDomain && match.PublicSuffixes == "":
+		key := NormalizeHost(match.Value)
+		m.domains[key] = append(m.domains[key], ref)
+	case match.isPlain() && match.Type == BrowserMatchTypeSite:
+		key := normalizeSite(match.Value)
+		m.sites[key] = append(m.sites[key], ref)
+	default:
+		cond, err := compileRule(match)
+		if err != nil {
+			return err
+		}
+		m.compiled = append(m.compiled, compiledRule{ref: ref, condition: cond})
+	}
+
+	return nil
+}
+
+// compileRule compiles a rule with all of its sub-conditions and exclusions into a single condition
+func compileRule(match BrowserMatch) (condition, error) {
+	var required, excluded []condition
+
+	if match.Type == "" && len(match.All) == 0 {
+		return nil, ErrEmptyRule
+	}
+
+	if match.Type != "" {
+		cond, err := compileCondition(match)
+		if err != nil {
+			return nil, err
+		}
+		required = append(required, cond)
+	}
+
+	for i := range match.All {
+		cond, err := compileRule(match.All[i])
+		if err != nil {
+			return nil, fmt.Errorf("all #%d: %w", i, err)
+		}
+		required = append(required, cond)
+	}
+
+	for i := range match.Not {
+		cond, err := compileRule(match.Not[i])
+		if err != nil {
+			return nil, fmt.Errorf("not #%d: %w", i, err)
+		}
+		excluded = append(excluded, cond)
+	}
+
+	if match.When != nil {
+		schedule, err := compileSchedule(match.When)
+		if err != nil {
+			return nil, fmt.Errorf("when: %w", err)
+		}
+		required = append(required, func(in *matchInput) bool {
+			return schedule.matches(in.now)
+		})
+	}
+
+	if match.ExpiresAt != nil {
+		expiresAt := *match.ExpiresAt
+		required = append(required, func(in *matchInput) bool {
+			return in.now.Before(expiresAt)
+		})
+	}
+
+	if len(required) == 1 && len(excluded) == 0 {
+		return required[0], nil
+	}
+
+	return func(in *matchInput) bool {
+		for _, cond := range required {
+			if !cond(in) {
+				return false
+			}
+		}
+		for _, cond := range excluded {
+			if cond(in) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// compileCondition compiles the condition of a single rule type
+func compileCondition(match BrowserMatch) (condition, error) {
+	switch match.Type {
+	case BrowserMatchTypeSite:
+		site := normalizeSite(match.Value)
+		return func(in *matchInput) bool {
+			return in.site != "" && (in.site == site || in.sitePort == site)
+		}, nil
+	case BrowserMatchTypeDomain:
+		domain := NormalizeHost(match.Value)
+		switch match.PublicSuffixes {
+		case "", PublicSuffixesPrivate:
+			return func(in *matchInput) bool {
+				return in.domain != "" && in.domain == domain
+			}, nil
+		case PublicSuffixesIcann:
+			return func(in *matchInput) bool {
+				return in.icannDomain != "" && in.icannDomain == domain
+			}, nil
+		default:
+			return nil, fmt.Errorf("%w `%s`", ErrUnknownPublicSuffixes, match.PublicSuffixes)
+		}
+	case BrowserMatchTypeHostSuffix:
+		suffix := NormalizeHost(strings.TrimPrefix(match.Value, "."))
+		if suffix == "" {
+			return nil, ErrEmptyHostSuffix
+		}
+		return func(in *matchInput) bool {
+			return in.site == suffix || strings.HasSuffix(in.site, "."+suffix)
+		}, nil
+	case BrowserMatchTypeRegex:
+		re, err := regexp.Compile(match.Value)
+		if err != nil {
+			return nil, err
+		}
+		return func(in *matchInput) bool {
+			return re.MatchString(in.raw)
+		}, nil
+	case BrowserMatchTypeGlob:
+		glob, err := compileGlob(match.Value)
+		if err != nil {
+			return nil, err
+		}
+		return func(in *matchInput) bool {
+			return in.parsed != nil && glob.matches(in.parsed)
+		}, nil
+	case BrowserMatchTypePathPrefix:
+		prefix, err := compilePathPrefix(match.Value)
+		if err != nil {
+			return nil, err
+		}
+		return func(in *matchInput) bool {
+			return in.parsed != nil && prefix.matches(in.parsed)
+		}, nil
+	case BrowserMatchTypeQuery:
+		query, err := compileQuery(match.Value)
+		if err != nil {
+			return nil, err
+		}
+		return func(in *matchInput) bool {
+			return in.parsed != nil && query.matches(in.parsed)
+		}, nil
+	case BrowserMatchTypeSourceApp:
+		name := match.Value
+		return func(in *matchInput) bool {
+			return in.env.SourceApp.Is(name)
+		}, nil
+	case BrowserMatchTypeNetworkInterface:
+		pattern := match.Value
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+		return func(in *matchInput) bool {
+			return in.getNetwork().hasInterface(pattern)
+		}, nil
+	case BrowserMatchTypeNetworkCidr:
+		prefix, err := netip.ParsePrefix(match.Value)
+		if err != nil {
+			return nil, err
+		}
+		return func(in *matchInput) bool {
+			return in.getNetwork().hasAddressIn(prefix)
+		}, nil
+	case BrowserMatchTypeDnsSearchDomain:
+		domain := strings.TrimSuffix(match.Value, ".")
+		return func(in *matchInput) bool {
+			return in.getNetwork().hasSearchDomain(domain)
+		}, nil
+	default:
+		return nil, ErrUnknownMatchType
+	}
+}
+
+// Match returns the browser with the best rule matching the given URL. By default the first browser (in the order of
+// the settings) having any matching rule wins, unless the rules have explicit priorities or the settings use the
+// most-specific -resolution mode. The rules locked by a policy win over all the others regardless, and the rules of the
+// subscriptions lose to all the others.
+func (m *Matcher) Match(u string) (*MatchResult, error) {
+	in := newMatchInput(u, m.env)
+
+	var best ruleRef
+	found := false
+	consider := func(refs ...ruleRef) {
+		for _, ref := range refs {
+			if !found || m.better(ref, best) {
+				best = ref
+				found = true
+			}
+		}
+	}
+
+	if in.site != "" {
+		consider(m.sites[in.site]...)
+	}
+
+	if in.sitePort != "" {
+		consider(m.sites[in.sitePort]...)
+	}
+
+	if in.domain != "" {
+		consider(m.domains[in.domain]...)
+	}
+
+	for i := range m.compiled {
+		// the rules are in the order of the settings, so unless every rule has to be evaluated we can stop as soon as
+		// the rules can no longer beat the best match so far
+		if !m.exhaustive && found && !m.better(m.compiled[i].ref, best) {
+			break
+		}
+		if m.compiled[i].condition(in) {
+			consider(m.compiled[i].ref)
+		}
+	}
+
+	if !found {
+		return nil, ErrNoMatchFound
+	}
+
+	result := m.result(best)
+
+	result.Url = u
+	if rewrite, found := m.rewrites[best]; found {
+		result.Url = rewrite.apply(u)
+	}
+
+	return result, nil
+}
+
+// RuleEvaluation is the outcome of evaluating a single rule against a URL
+type RuleEvaluation struct {
+	// Action is RuleActionOpen for the browser-rules and the action of the rule for the top-level rules
+	Action string
+
+	// Mode is the name of the mode the top-level rule belongs to; empty for the global rules
+	Mode string
+
+	// BrowserIndex is -1 for the top-level rules, which only have a browser with RuleActionOpen
+	BrowserIndex int
+	Browser      Browser
+	RuleIndex    int
+	Rule         BrowserMatch
+
+	Matched bool
+
+	// Err is set if the rule is invalid and therefore never matches
+	Err error
+}
+
+// Explain evaluates the top-level rules (of the active mode first) and every rule of every browser against the given
+// URL. Unlike Match it doesn't stop at the best match, so it's meant for finding out why a URL matches (or doesn't)
+// rather than for the actual matching.
+func (m *Matcher) Explain(u string) []RuleEvaluation {
+	in := newMatchInput(u, m.env)
+
+	var evaluations []RuleEvaluation
+
+	if m.mode != nil {
+		evaluations = append(evaluations, m.explainTopLevelRules(in, m.mode.Rules, m.mode.Name)...)
+	}
+
+	evaluations = append(evaluations, m.explainTopLevelRules(in, m.rules, "")...)
+
+	for i := range m.browsers {
+		for j := range m.browsers[i].Matches {
+			evaluation := RuleEvaluation{
+				Action:       RuleActionOpen,
+				BrowserIndex: i,
+				Browser:      Browser{Name: m.browsers[i].Name, Command: m.browsers[i].Command},
+				RuleIndex:    j,
+				Rule:         m.browsers[i].Matches[j],
+			}
+
+			if cond, err := compileExplainedRule(m.browsers[i].Matches[j]); err != nil {
+				evaluation.Err = err
+			} else {
+				evaluation.Matched = cond(in)
+			}
+
+			evaluations = append(evaluations, evaluation)
+		}
+	}
+
+	return evaluations
+}
+
+func (m *Matcher) explainTopLevelRules(in *matchInput, rules []Rule, mode string) []RuleEvaluation {
+	evaluations := make([]RuleEvaluation, 0, len(rules))
+
+	for i := range rules {
+		evaluation := RuleEvaluation{
+			Action:       rules[i].Action,
+			Mode:         mode,
+			BrowserIndex: -1,
+			RuleIndex:    i,
+			Rule:         rules[i].BrowserMatch,
+		}
+
+		browserIndex, err := resolveRuleBrowser(&rules[i], m.browsers)
+		if browserIndex >= 0 {
+			evaluation.Browser = Browser{Name: m.browsers[browserIndex].Name, Command: m.browsers[browserIndex].Command}
+		}
+
+		var cond condition
+		if err == nil {
+			cond, err = compileExplainedRule(rules[i].BrowserMatch)
+		}
+
+		if err != nil {
+			evaluation.Err = err
+		} else {
+			evaluation.Matched = cond(in)
+		}
+
+		evaluations = append(evaluations, evaluation)
+	}
+
+	return evaluations
+}
+
+// compileExplainedRule compiles the rule for Explain, failing on the same errors as NewMatcher does
+func compileExplainedRule(match BrowserMatch) (condition, error) {
+	if match.Rewrite != nil {
+		if _, err := compileRewrite(match.Rewrite); err != nil {
+			return nil, err
+		}
+	}
+
+	return compileRule(match)
+}
+
+// better returns true if the rule a should win over the rule b: the higher priority wins, followed by the more specific
+// rule in the most-specific -resolution mode and finally the one appearing first in the settings. A locked rule wins
+// and a subscribed rule loses regardless.
+func (m *Matcher) better(a, b ruleRef) bool {
+	if a.locked != b.locked {
+		return a.locked
+	}
+
+	if a.subscribed != b.subscribed {
+		return b.subscribed
+	}
+
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+
+	if m.mostSpecific && a.specificity != b.specificity {
+		return a.specificity > b.specificity
+	}
+
+	if a.browser != b.browser {
+		return a.browser < b.browser
+	}
+
+	return a.rule < b.rule
+}
+
+func (m *Matcher) result(ref ruleRef) *MatchResult {
+	if ref.browser < 0 {
+		var rule *Rule
+		mode := ""
+		if ref.browser == modeRulesIndex {
+			rule = &m.mode.Rules[ref.rule]
+			mode = m.mode.Name
+		} else {
+			rule = &m.rules[ref.rule]
+		}
+
+		result := &MatchResult{
+			Action:       rule.Action,
+			BrowserIndex: -1,
+			RuleIndex:    ref.rule,
+			Rule:         rule.BrowserMatch,
+			TopLevelRule: rule,
+			Mode:         mode,
+		}
+
+		if browserIndex, found := m.ruleBrowsers[ruleKey{browser: ref.browser, rule: ref.rule}]; found {
+			result.Browser = Browser{Name: m.browsers[browserIndex].Name, Command: m.browsers[browserIndex].Command}
+			result.BrowserIndex = browserIndex
+		}
+
+		return result
+	}
+
+	browser := &m.browsers[ref.browser]
+
+	return &MatchResult{
+		Action: RuleActionOpen,
+		Browser: Browser{
+			Name:    browser.Name,
+			Command: browser.Command,
+		},
+		BrowserIndex: ref.browser,
+		RuleIndex:    ref.rule,
+		Rule:         browser.Matches[ref.rule],
+	}
+}
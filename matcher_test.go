@@ -0,0 +1,919 @@
+package linkquisition_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestMatcher_Match(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Firefox",
+				Command: "firefox %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "www.example.com"},
+					{Type: BrowserMatchTypeRegex, Value: `^https?://github\.com/Strobotti/`},
+				},
+			},
+			{
+				Name:    "Chromium",
+				Command: "chromium %U",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeDomain, Value: "Example.com"},
+					{Type: BrowserMatchTypeSite, Value: "github.com"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range [...]struct {
+		name            string
+		url             string
+		expectedBrowser string
+		expectedRule    int
+		expectErr       bool
+	}{
+		{
+			name:            "site rule of the first browser wins over the domain rule of the second",
+			url:             "https://www.example.com/path",
+			expectedBrowser: "Firefox",
+			expectedRule:    0,
+		},
+		{
+			name:            "domain rule matches other subdomains, case-insensitively",
+			url:             "https://SUB.example.com/path",
+			expectedBrowser: "Chromium",
+			expectedRule:    0,
+		},
+		{
+			name:            "regex rule of the first browser wins over the site rule of the second",
+			url:             "https://github.com/Strobotti/linkquisition",
+			expectedBrowser: "Firefox",
+			expectedRule:    1,
+		},
+		{
+			name:            "site rule of the second browser matches when the regex does not",
+			url:             "https://github.com/someone-else",
+			expectedBrowser: "Chromium",
+			expectedRule:    1,
+		},
+		{
+			name:      "no rule matches",
+			url:       "https://www.example.org/",
+			expectErr: true,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				m, err := NewMatcher(settings)
+				require.NoError(t, err)
+
+				result, err := m.Match(tt.url)
+				if tt.expectErr {
+					assert.ErrorIs(t, err, ErrNoMatchFound)
+					return
+				}
+
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBrowser, result.Browser.Name)
+				assert.Equal(t, tt.expectedRule, result.RuleIndex)
+			},
+		)
+	}
+}
+
+func TestMatcher_Match_Hosts(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Firefox",
+				Command: "firefox %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "localhost:8080"},
+					{Type: BrowserMatchTypeDomain, Value: "bücher.de"},
+					{Type: BrowserMatchTypePathPrefix, Value: "[::1]/admin"},
+				},
+			},
+			{
+				Name:    "Chromium",
+				Command: "chromium %U",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "localhost"},
+					{Type: BrowserMatchTypeSite, Value: "xn--mller-kva.example"},
+					{Type: BrowserMatchTypeGlob, Value: "*.straße.example"},
+					{Type: BrowserMatchTypeSite, Value: "wiki"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range [...]struct {
+		name            string
+		url             string
+		expectedBrowser string
+		expectedRule    int
+	}{
+		{
+			name:            "site rule with a port matches only that port",
+			url:             "http://localhost:8080/",
+			expectedBrowser: "Firefox",
+			expectedRule:    0,
+		},
+		{
+			name:            "site rule without a port matches any port",
+			url:             "http://localhost:3000/",
+			expectedBrowser: "Chromium",
+			expectedRule:    0,
+		},
+		{
+			name:            "unicode domain rule matches a punycode link",
+			url:             "https://www.xn--bcher-kva.de/",
+			expectedBrowser: "Firefox",
+			expectedRule:    1,
+		},
+		{
+			name:            "unicode domain rule matches a unicode link",
+			url:             "https://www.BÜCHER.de/",
+			expectedBrowser: "Firefox",
+			expectedRule:    1,
+		},
+		{
+			name:            "punycode site rule matches a unicode link",
+			url:             "https://müller.example/",
+			expectedBrowser: "Chromium",
+			expectedRule:    1,
+		},
+		{
+			name:            "path prefix rule matches an ipv6 host with userinfo and a port",
+			url:             "http://admin@[::1]:9000/admin/users",
+			expectedBrowser: "Firefox",
+			expectedRule:    2,
+		},
+		{
+			name:            "unicode glob matches a punycode link",
+			url:             "https://shop.xn--strae-oqa.example/",
+			expectedBrowser: "Chromium",
+			expectedRule:    2,
+		},
+		{
+			name:            "single-label intranet host matches",
+			url:             "http://wiki/start",
+			expectedBrowser: "Chromium",
+			expectedRule:    3,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				m, err := NewMatcher(settings)
+				require.NoError(t, err)
+
+				result, err := m.Match(tt.url)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBrowser, result.Browser.Name)
+				assert.Equal(t, tt.expectedRule, result.RuleIndex)
+			},
+		)
+	}
+}
+
+func TestMatcher_Match_HostSuffixAndPublicSuffixes(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Firefox",
+				Command: "firefox %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeHostSuffix, Value: "corp.example.com"},
+					{Type: BrowserMatchTypeDomain, Value: "github.io", PublicSuffixes: PublicSuffixesIcann},
+				},
+			},
+			{
+				Name:    "Chromium",
+				Command: "chromium %U",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeDomain, Value: "example.com"},
+					{Type: BrowserMatchTypeDomain, Value: "herokuapp.com"},
+					{Type: BrowserMatchTypeHostSuffix, Value: ".herokuapp.com"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range [...]struct {
+		name            string
+		url             string
+		expectedBrowser string
+		expectedRule    int
+	}{
+		{
+			name:            "host suffix matches the host itself",
+			url:             "https://corp.example.com/",
+			expectedBrowser: "Firefox",
+			expectedRule:    0,
+		},
+		{
+			name:            "host suffix matches the subdomains",
+			url:             "https://wiki.eu.corp.example.com/",
+			expectedBrowser: "Firefox",
+			expectedRule:    0,
+		},
+		{
+			name:            "host suffix does not match the parent domain",
+			url:             "https://www.example.com/",
+			expectedBrowser: "Chromium",
+			expectedRule:    0,
+		},
+		{
+			name:            "host suffix matches on label boundaries only",
+			url:             "https://mycorp.example.com/",
+			expectedBrowser: "Chromium",
+			expectedRule:    0,
+		},
+		{
+			name:            "domain with icann suffixes matches the sites under a private suffix",
+			url:             "https://someone.github.io/project",
+			expectedBrowser: "Firefox",
+			expectedRule:    1,
+		},
+		{
+			name:            "domain with private suffixes does not match the sites under the private suffix",
+			url:             "https://my-app.herokuapp.com/",
+			expectedBrowser: "Chromium",
+			expectedRule:    2,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				m, err := NewMatcher(settings)
+				require.NoError(t, err)
+
+				result, err := m.Match(tt.url)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBrowser, result.Browser.Name)
+				assert.Equal(t, tt.expectedRule, result.RuleIndex)
+			},
+		)
+	}
+}
+
+func TestMatcher_Match_Resolution(t *testing.T) {
+	browsers := func(domainPriority int) []BrowserSettings {
+		return []BrowserSettings{
+			{
+				Name:    "Personal",
+				Command: "firefox -P personal %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeDomain, Value: "github.com", Priority: domainPriority},
+				},
+			},
+			{
+				Name:    "Work",
+				Command: "firefox -P work %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "gist.github.com"},
+					{Type: BrowserMatchTypePathPrefix, Value: "github.com/our-org"},
+				},
+			},
+			{
+				Name:    "Sandbox",
+				Command: "chromium %U",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "github.com"},
+				},
+			},
+		}
+	}
+
+	for _, tt := range [...]struct {
+		name            string
+		settings        *Settings
+		url             string
+		expectedBrowser string
+	}{
+		{
+			name:            "order-resolution lets the broad domain rule of the first browser win",
+			settings:        &Settings{Browsers: browsers(0)},
+			url:             "https://gist.github.com/someone",
+			expectedBrowser: "Personal",
+		},
+		{
+			name:            "most-specific -resolution lets the site rule win over the domain rule",
+			settings:        &Settings{Browsers: browsers(0), Resolution: ResolutionMostSpecific},
+			url:             "https://gist.github.com/someone",
+			expectedBrowser: "Work",
+		},
+		{
+			name:            "most-specific -resolution lets the path rule win over the site rule",
+			settings:        &Settings{Browsers: browsers(0), Resolution: ResolutionMostSpecific},
+			url:             "https://github.com/our-org/repo",
+			expectedBrowser: "Work",
+		},
+		{
+			name:            "most-specific -resolution falls back to the order with equally specific rules",
+			settings:        &Settings{Browsers: browsers(0), Resolution: ResolutionMostSpecific},
+			url:             "https://github.com/someone-else",
+			expectedBrowser: "Sandbox",
+		},
+		{
+			name:            "an explicit priority wins over the more specific rules",
+			settings:        &Settings{Browsers: browsers(10), Resolution: ResolutionMostSpecific},
+			url:             "https://github.com/our-org/repo",
+			expectedBrowser: "Personal",
+		},
+		{
+			name: "an explicit priority wins over the order",
+			settings: &Settings{
+				Browsers: []BrowserSettings{
+					{
+						Name:    "Personal",
+						Command: "firefox -P personal %u",
+						Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "github.com"}},
+					},
+					{
+						Name:    "Work",
+						Command: "firefox -P work %u",
+						Matches: []BrowserMatch{{Type: BrowserMatchTypeRegex, Value: `^https://github\.com/`, Priority: 1}},
+					},
+				},
+			},
+			url:             "https://github.com/our-org/repo",
+			expectedBrowser: "Work",
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				browser, err := tt.settings.GetMatchingBrowser(tt.url)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBrowser, browser.Name)
+			},
+		)
+	}
+}
+
+func TestSettings_GetMatchingBrowser_SourceApp(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Work",
+				Command: "firefox -P work %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSourceApp, Value: "teams-for-linux"},
+				},
+			},
+			{
+				Name:    "Personal",
+				Command: "firefox -P personal %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSourceApp, Value: "signal-desktop"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range [...]struct {
+		name            string
+		sourceApp       *SourceApp
+		expectedBrowser string
+	}{
+		{
+			name:            "matches the desktop file id",
+			sourceApp:       &SourceApp{DesktopFile: "/usr/share/applications/teams-for-linux.desktop"},
+			expectedBrowser: "Work",
+		},
+		{
+			name:            "matches any of the ancestor processes",
+			sourceApp:       &SourceApp{Processes: []string{"xdg-open", "Signal-Desktop"}},
+			expectedBrowser: "Personal",
+		},
+		{
+			name:      "does not match other apps",
+			sourceApp: &SourceApp{Processes: []string{"xdg-open", "thunderbird"}},
+		},
+		{
+			name: "does not match when the source app is unknown",
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				settings.Environment.SourceApp = tt.sourceApp
+
+				browser, err := settings.GetMatchingBrowser("https://www.example.com/")
+				if tt.expectedBrowser == "" {
+					assert.ErrorIs(t, err, ErrNoMatchFound)
+					return
+				}
+
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBrowser, browser.Name)
+			},
+		)
+	}
+}
+
+type fakeNetworkProbe struct {
+	interfaces    []NetworkInterface
+	searchDomains []string
+	probes        int
+}
+
+func (p *fakeNetworkProbe) Interfaces() ([]NetworkInterface, error) {
+	p.probes++
+	return p.interfaces, nil
+}
+
+func (p *fakeNetworkProbe) SearchDomains() ([]string, error) {
+	return p.searchDomains, nil
+}
+
+func TestSettings_GetMatchingBrowser_Network(t *testing.T) {
+	vpnUp := &fakeNetworkProbe{
+		interfaces: []NetworkInterface{
+			{Name: "lo", Addresses: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/8")}},
+			{Name: "wg0", Addresses: []netip.Prefix{netip.MustParsePrefix("10.20.30.40/24")}},
+		},
+		searchDomains: []string{"corp.example.com."},
+	}
+	vpnDown := &fakeNetworkProbe{
+		interfaces: []NetworkInterface{
+			{Name: "lo", Addresses: []netip.Prefix{netip.MustParsePrefix("127.0.0.1/8")}},
+			{Name: "wlan0", Addresses: []netip.Prefix{netip.MustParsePrefix("192.168.1.10/24")}},
+		},
+		searchDomains: []string{"home.arpa"},
+	}
+
+	for _, tt := range [...]struct {
+		name     string
+		rule     BrowserMatch
+		probe    NetworkProbe
+		expected bool
+	}{
+		{
+			name:     "interface is present",
+			rule:     BrowserMatch{Type: BrowserMatchTypeNetworkInterface, Value: "wg0"},
+			probe:    vpnUp,
+			expected: true,
+		},
+		{
+			name:     "interface is present by a wildcard",
+			rule:     BrowserMatch{Type: BrowserMatchTypeNetworkInterface, Value: "wg*"},
+			probe:    vpnUp,
+			expected: true,
+		},
+		{
+			name:     "interface is not present",
+			rule:     BrowserMatch{Type: BrowserMatchTypeNetworkInterface, Value: "wg0"},
+			probe:    vpnDown,
+			expected: false,
+		},
+		{
+			name:     "address is within the CIDR",
+			rule:     BrowserMatch{Type: BrowserMatchTypeNetworkCidr, Value: "10.0.0.0/8"},
+			probe:    vpnUp,
+			expected: true,
+		},
+		{
+			name:     "address is not within the CIDR",
+			rule:     BrowserMatch{Type: BrowserMatchTypeNetworkCidr, Value: "10.0.0.0/8"},
+			probe:    vpnDown,
+			expected: false,
+		},
+		{
+			name:     "search domain is set",
+			rule:     BrowserMatch{Type: BrowserMatchTypeDnsSearchDomain, Value: "Corp.Example.com"},
+			probe:    vpnUp,
+			expected: true,
+		},
+		{
+			name:     "search domain is not set",
+			rule:     BrowserMatch{Type: BrowserMatchTypeDnsSearchDomain, Value: "corp.example.com"},
+			probe:    vpnDown,
+			expected: false,
+		},
+		{
+			name:     "network conditions never match without a probe",
+			rule:     BrowserMatch{Type: BrowserMatchTypeNetworkInterface, Value: "*"},
+			expected: false,
+		},
+		{
+			name: "internal site goes to the browser only when the VPN is up",
+			rule: BrowserMatch{
+				Type:  BrowserMatchTypeSite,
+				Value: "jira.corp.example.com",
+				All:   []BrowserMatch{{Type: BrowserMatchTypeNetworkInterface, Value: "wg0"}},
+			},
+			probe:    vpnDown,
+			expected: false,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				settings := &Settings{
+					Browsers: []BrowserSettings{
+						{Name: "Work", Command: "firefox -P work %u", Matches: []BrowserMatch{tt.rule}},
+					},
+					Environment: MatchEnvironment{Network: tt.probe},
+				}
+
+				_, compileErr := settings.GetMatcher()
+				require.NoError(t, compileErr)
+
+				_, err := settings.GetMatchingBrowser("https://jira.corp.example.com/browse/ABC-1")
+				assert.Equal(t, tt.expected, err == nil)
+			},
+		)
+	}
+}
+
+func TestSettings_GetMatchingBrowser_ProbesNetworkOnlyWhenNeeded(t *testing.T) {
+	probe := &fakeNetworkProbe{interfaces: []NetworkInterface{{Name: "tun0"}}}
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Work",
+				Command: "firefox -P work %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "www.example.com"},
+					{Type: BrowserMatchTypeNetworkInterface, Value: "tun0"},
+					{Type: BrowserMatchTypeNetworkCidr, Value: "10.0.0.0/8"},
+				},
+			},
+		},
+		Environment: MatchEnvironment{Network: probe},
+	}
+
+	_, err := settings.GetMatchingBrowser("https://www.example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, 0, probe.probes)
+
+	_, err = settings.GetMatchingBrowser("https://www.example.org/")
+	require.NoError(t, err)
+	assert.Equal(t, 1, probe.probes)
+}
+
+func TestMatcher_Explain(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Firefox",
+				Command: "firefox %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "www.example.org"},
+					{Type: BrowserMatchTypeRegex, Value: `^https://(broken`},
+				},
+			},
+			{
+				Name:    "Chromium",
+				Command: "chromium %U",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeDomain, Value: "example.com"},
+					{Type: BrowserMatchTypeSite, Value: "www.example.com"},
+				},
+			},
+		},
+	}
+
+	m, _ := NewMatcher(settings)
+	evaluations := m.Explain("https://www.example.com/")
+
+	require.Len(t, evaluations, 4)
+
+	assert.Equal(t, "Firefox", evaluations[0].Browser.Name)
+	assert.False(t, evaluations[0].Matched)
+	assert.NoError(t, evaluations[0].Err)
+
+	assert.False(t, evaluations[1].Matched)
+	assert.Error(t, evaluations[1].Err)
+
+	assert.Equal(t, "Chromium", evaluations[2].Browser.Name)
+	assert.Equal(t, 0, evaluations[2].RuleIndex)
+	assert.True(t, evaluations[2].Matched)
+
+	assert.Equal(t, 1, evaluations[3].RuleIndex)
+	assert.True(t, evaluations[3].Matched)
+}
+
+func TestNewMatcher_ReportsInvalidRules(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Firefox",
+				Command: "firefox %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeRegex, Value: `^https://(broken`},
+					{Type: "hostname", Value: "www.example.com"},
+					{Type: BrowserMatchTypeSite, Value: "www.example.org"},
+				},
+			},
+		},
+	}
+
+	m, err := NewMatcher(settings)
+	require.Error(t, err)
+
+	var ruleErr *RuleError
+	require.ErrorAs(t, err, &ruleErr)
+	assert.Equal(t, "Firefox", ruleErr.Browser)
+	assert.Equal(t, 0, ruleErr.RuleIndex)
+	assert.ErrorIs(t, err, ErrUnknownMatchType)
+
+	// the valid rules are still usable
+	result, matchErr := m.Match("https://www.example.org/")
+	require.NoError(t, matchErr)
+	assert.Equal(t, 2, result.RuleIndex)
+}
+
+func TestMatcher_Match_TopLevelRules(t *testing.T) {
+	browsers := []BrowserSettings{
+		{
+			Name:    "Firefox",
+			Command: "firefox %u",
+			Matches: []BrowserMatch{
+				{Type: BrowserMatchTypeDomain, Value: "example.com"},
+				{Type: BrowserMatchTypeSite, Value: "docs.example.com"},
+			},
+		},
+		{Name: "Chromium", Command: "chromium %U"},
+	}
+
+	rules := []Rule{
+		{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeDomain, Value: "phishing.example"}, Action: RuleActionBlock},
+		{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "shop.example.com"}, Action: RuleActionAsk},
+		{BrowserMatch: BrowserMatch{Type: BrowserMatchTypePathPrefix, Value: "example.com/share"}, Action: RuleActionCopy},
+		{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "intranet.example.org"}, Action: RuleActionSystemDefault},
+		{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeDomain, Value: "example.com"}, Action: RuleActionOpen, Browser: "Chromium"},
+	}
+
+	for _, tt := range [...]struct {
+		name            string
+		resolution      string
+		url             string
+		expectedAction  string
+		expectedBrowser string
+		expectTopLevel  bool
+	}{
+		{
+			name:           "blocking rule",
+			url:            "https://login.phishing.example/",
+			expectedAction: RuleActionBlock,
+			expectTopLevel: true,
+		},
+		{
+			name:           "ask-rule wins over the broader browser-rule",
+			url:            "https://shop.example.com/",
+			expectedAction: RuleActionAsk,
+			expectTopLevel: true,
+		},
+		{
+			name:           "ask-rule wins over the broader browser-rule in the most-specific -mode",
+			resolution:     ResolutionMostSpecific,
+			url:            "https://shop.example.com/",
+			expectedAction: RuleActionAsk,
+			expectTopLevel: true,
+		},
+		{
+			name:           "copy-rule",
+			url:            "https://example.com/share/123",
+			expectedAction: RuleActionCopy,
+			expectTopLevel: true,
+		},
+		{
+			name:           "system-default -rule",
+			url:            "https://intranet.example.org/",
+			expectedAction: RuleActionSystemDefault,
+			expectTopLevel: true,
+		},
+		{
+			name:            "top-level open-rule comes before the browser-rules in order",
+			url:             "https://docs.example.com/",
+			expectedAction:  RuleActionOpen,
+			expectedBrowser: "Chromium",
+			expectTopLevel:  true,
+		},
+		{
+			name:            "more specific browser-rule wins over the top-level rule in the most-specific -mode",
+			resolution:      ResolutionMostSpecific,
+			url:             "https://docs.example.com/",
+			expectedAction:  RuleActionOpen,
+			expectedBrowser: "Firefox",
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				m, err := NewMatcher(&Settings{Browsers: browsers, Rules: rules, Resolution: tt.resolution})
+				require.NoError(t, err)
+
+				result, err := m.Match(tt.url)
+				require.NoError(t, err)
+
+				assert.Equal(t, tt.expectedAction, result.Action)
+				assert.Equal(t, tt.expectedBrowser, result.Browser.Name)
+				assert.Equal(t, tt.expectTopLevel, result.TopLevelRule != nil)
+			},
+		)
+	}
+}
+
+func TestSettings_GetMatchingBrowser_TopLevelRules(t *testing.T) {
+	settings := &Settings{}
+	require.NoError(
+		t, json.Unmarshal(
+			[]byte(`{
+  "browsers": [{"name": "Firefox", "command": "firefox %u"}],
+  "rules": [
+    {"type": "domain", "value": "tracker.example", "action": "block"},
+    {"type": "site", "value": "www.example.com", "action": "open", "browser": "Firefox"},
+    {"type": "site", "value": "www.example.org", "action": "launch"},
+    {"type": "site", "value": "www.example.net", "action": "open", "browser": "Opera"}
+  ]
+}`), settings,
+		),
+	)
+
+	assert.Equal(t, RuleActionBlock, settings.Rules[0].Action)
+	assert.Equal(t, BrowserMatchTypeDomain, settings.Rules[0].Type)
+
+	_, compileErr := settings.GetMatcher()
+	assert.ErrorIs(t, compileErr, ErrUnknownAction)
+	assert.ErrorIs(t, compileErr, ErrUnknownBrowser)
+
+	browser, err := settings.GetMatchingBrowser("https://www.example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "Firefox", browser.Name)
+
+	_, err = settings.GetMatchingBrowser("https://ads.tracker.example/")
+	assert.ErrorIs(t, err, ErrNoBrowserAction)
+
+	_, err = settings.GetMatchingBrowser("https://www.example.org/")
+	assert.ErrorIs(t, err, ErrNoMatchFound)
+}
+
+func TestSettings_GetMatchingBrowser_Modes(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "github.com"}}},
+			{Name: "Client A", Command: "firefox -P client-a %u"},
+			{Name: "Client B", Command: "firefox -P client-b %u"},
+		},
+		Rules: []Rule{
+			{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeDomain, Value: "tracker.example"}, Action: RuleActionBlock},
+		},
+		Modes: []Mode{
+			{
+				Name: "client-a",
+				Rules: []Rule{
+					{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeDomain, Value: "atlassian.net"}, Action: RuleActionOpen, Browser: "Client A"},
+					{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "github.com"}, Action: RuleActionOpen, Browser: "Client A"},
+				},
+			},
+			{
+				Name: "client-b",
+				Rules: []Rule{
+					{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeDomain, Value: "atlassian.net"}, Action: RuleActionOpen, Browser: "Client B"},
+				},
+			},
+		},
+	}
+
+	for _, tt := range [...]struct {
+		mode     string
+		url      string
+		expected string
+	}{
+		{mode: "", url: "https://acme.atlassian.net/", expected: ""},
+		{mode: "", url: "https://github.com/", expected: "Firefox"},
+		{mode: "client-a", url: "https://acme.atlassian.net/", expected: "Client A"},
+		{mode: "client-a", url: "https://github.com/", expected: "Client A"},
+		{mode: "client-b", url: "https://acme.atlassian.net/", expected: "Client B"},
+		{mode: "client-b", url: "https://github.com/", expected: "Firefox"},
+	} {
+		t.Run(
+			fmt.Sprintf("%s %s", tt.mode, tt.url), func(t *testing.T) {
+				require.NoError(t, settings.SetActiveMode(tt.mode))
+
+				browser, err := settings.GetMatchingBrowser(tt.url)
+				if tt.expected == "" {
+					assert.ErrorIs(t, err, ErrNoMatchFound)
+					return
+				}
+
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, browser.Name)
+
+				// the global rules apply in every mode
+				_, err = settings.GetMatchingBrowser("https://ads.tracker.example/")
+				assert.ErrorIs(t, err, ErrNoBrowserAction)
+			},
+		)
+	}
+
+	assert.ErrorIs(t, settings.SetActiveMode("client-c"), ErrUnknownMode)
+
+	settings.ActiveMode = "client-c"
+	m, err := NewMatcher(settings)
+	assert.ErrorIs(t, err, ErrUnknownMode)
+
+	result, err := m.Match("https://github.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "Firefox", result.Browser.Name)
+}
+
+func TestSettings_GetMatchingBrowser_RecompilesAfterAddingRule(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u"},
+		},
+	}
+
+	_, err := settings.GetMatchingBrowser("https://www.example.com/")
+	assert.True(t, errors.Is(err, ErrNoMatchFound))
+
+	settings.AddRuleToBrowser(&Browser{Name: "Firefox", Command: "firefox %u"}, BrowserMatchTypeSite, "www.example.com")
+
+	browser, err := settings.GetMatchingBrowser("https://www.example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "Firefox", browser.Name)
+}
+
+func TestSettings_GetMatchingBrowser_RecompilesAfterChangingRulesDirectly(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u"},
+			{Name: "Chromium", Command: "chromium %U"},
+		},
+	}
+
+	_, err := settings.GetMatchingBrowser("https://www.example.com/")
+	assert.True(t, errors.Is(err, ErrNoMatchFound))
+
+	settings.Browsers[0].Matches = append(
+		settings.Browsers[0].Matches,
+		BrowserMatch{Type: BrowserMatchTypeSite, Value: "www.example.com"},
+	)
+
+	browser, err := settings.GetMatchingBrowser("https://www.example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "Firefox", browser.Name)
+
+	settings.Rules = []Rule{
+		{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "www.example.com"}, Action: RuleActionOpen, Browser: "Chromium"},
+	}
+
+	browser, err = settings.GetMatchingBrowser("https://www.example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "Chromium", browser.Name)
+}
+
+func TestBrowserSettings_MatchesUrl_RecompilesAfterChangingRules(t *testing.T) {
+	browser := &BrowserSettings{Name: "Firefox", Command: "firefox %u"}
+
+	assert.False(t, browser.MatchesUrl("https://www.example.com/"))
+
+	browser.Matches = append(browser.Matches, BrowserMatch{Type: BrowserMatchTypeSite, Value: "www.example.com"})
+
+	assert.True(t, browser.MatchesUrl("https://www.example.com/"))
+	assert.False(t, browser.MatchesUrl("https://www.example.org/"))
+}
+
+func BenchmarkMatcher_Match(b *testing.B) {
+	for _, ruleCount := range []int{10, 100, 1000, 10000} {
+		settings := &Settings{
+			Browsers: []BrowserSettings{
+				{Name: "Firefox", Command: "firefox %u"},
+				{Name: "Chromium", Command: "chromium %U"},
+			},
+		}
+
+		for i := range ruleCount {
+			browser := &settings.Browsers[i%len(settings.Browsers)]
+			browser.Matches = append(
+				browser.Matches,
+				BrowserMatch{Type: BrowserMatchTypeSite, Value: fmt.Sprintf("site%d.example.com", i)},
+				BrowserMatch{Type: BrowserMatchTypeDomain, Value: fmt.Sprintf("domain%d.org", i)},
+			)
+		}
+
+		m, err := NewMatcher(settings)
+		require.NoError(b, err)
+
+		u := fmt.Sprintf("https://site%d.example.com/some/path", ruleCount-1)
+
+		b.Run(
+			fmt.Sprintf("%d rules", ruleCount*2), func(b *testing.B) {
+				for b.Loop() {
+					if _, err := m.Match(u); err != nil {
+						b.Fatal(err)
+					}
+				}
+			},
+		)
+	}
+}
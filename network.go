@@ -0,0 +1,70 @@
+package linkquisition
+
+import (
+	"net/netip"
+	"path"
+	"slices"
+	"strings"
+)
+
+// NetworkInterface is a network interface which is up, along with its addresses
+type NetworkInterface struct {
+	Name      string
+	Addresses []netip.Prefix
+}
+
+// NetworkProbe inspects the state of the local network for the network-conditions of the rules
+type NetworkProbe interface {
+	// Interfaces returns the network interfaces which are up
+	Interfaces() ([]NetworkInterface, error)
+
+	// SearchDomains returns the DNS search domains in use
+	SearchDomains() ([]string, error)
+}
+
+// networkState is the state of the local network probed once per match and only if any rule needs it
+type networkState struct {
+	interfaces    []NetworkInterface
+	searchDomains []string
+}
+
+func probeNetwork(probe NetworkProbe) *networkState {
+	state := &networkState{}
+	if probe == nil {
+		return state
+	}
+
+	// failing to probe is treated as the network not having the interfaces or domains the rules are looking for
+	state.interfaces, _ = probe.Interfaces()
+	state.searchDomains, _ = probe.SearchDomains()
+
+	return state
+}
+
+func (n *networkState) hasInterface(pattern string) bool {
+	for i := range n.interfaces {
+		if matched, _ := path.Match(pattern, n.interfaces[i].Name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *networkState) hasAddressIn(prefix netip.Prefix) bool {
+	for i := range n.interfaces {
+		for _, address := range n.interfaces[i].Addresses {
+			if prefix.Contains(address.Addr()) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (n *networkState) hasSearchDomain(domain string) bool {
+	return slices.ContainsFunc(n.searchDomains, func(searchDomain string) bool {
+		return strings.EqualFold(strings.TrimSuffix(searchDomain, "."), domain)
+	})
+}
@@ -1,6 +1,11 @@
 package linkquisition
 
-import "log/slog"
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
 
 // PluginServiceProvider is an interface that provides the logger and settings to the plugin
 // This is passed to the plugin as a dependency when being setup.
@@ -36,3 +41,24 @@ func (p *pluginServiceProvider) GetSettings() *Settings {
 func NewPluginServiceProvider(logger *slog.Logger, settings *Settings) PluginServiceProvider {
 	return &pluginServiceProvider{logger: logger, Settings: settings}
 }
+
+// ResolvePluginPath returns the path to the plugin binary for the path given in the plugin settings. The `.so` -suffix
+// is optional and paths which don't exist as such are looked up from the given plugin folders, in order.
+func ResolvePluginPath(path string, folders []string) (string, bool) {
+	if !strings.HasSuffix(path, ".so") {
+		path += ".so"
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return path, true
+	}
+
+	for _, folder := range folders {
+		candidate := filepath.Join(folder, path)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
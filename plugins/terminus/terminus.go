@@ -21,6 +21,7 @@ type TerminusPluginSettings struct {
 const defaultRequestTimeoutMs = 2000
 
 var _ linkquisition.Plugin = (*terminus)(nil)
+var _ linkquisition.SchemaProvider = (*terminus)(nil)
 
 type terminus struct {
 	MaxRedirects    int
@@ -60,6 +61,11 @@ func (p *terminus) Setup(serviceProvider linkquisition.PluginServiceProvider, co
 	}
 }
 
+// GetSettingsSchema describes the settings of the plugin for the schema of the config-file
+func (p *terminus) GetSettingsSchema() map[string]any {
+	return linkquisition.GenerateSchema(TerminusPluginSettings{})
+}
+
 func (p *terminus) ModifyUrl(address string) string {
 	modifiedUrl := address
 
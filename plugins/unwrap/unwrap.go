@@ -28,6 +28,7 @@ type UnwrapPluginSettings struct {
 }
 
 var _ linkquisition.Plugin = (*unwrap)(nil)
+var _ linkquisition.SchemaProvider = (*unwrap)(nil)
 
 // unwrap is a plugin that unwraps URLs based on the rules provided in the settings
 type unwrap struct {
@@ -46,6 +47,11 @@ func (p *unwrap) Setup(serviceProvider linkquisition.PluginServiceProvider, conf
 	p.serviceProvider = serviceProvider
 }
 
+// GetSettingsSchema describes the settings of the plugin for the schema of the config-file
+func (p *unwrap) GetSettingsSchema() map[string]any {
+	return linkquisition.GenerateSchema(UnwrapPluginSettings{})
+}
+
 func (p *unwrap) ModifyUrl(u string) string {
 	for _, rule := range p.settings.Rules {
 		if rule.Match == "" {
@@ -0,0 +1,119 @@
+package linkquisition
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidScheme = errors.New("invalid scheme")
+
+var schemeRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*$`)
+
+// UrlRewrite changes the URL of a matching rule before it's opened. The changes are applied in the order of the fields.
+type UrlRewrite struct {
+	// Regex is substituted with Replace in the whole URL; Replace may refer to the capture groups as `$1` or `${name}`
+	Regex   string `json:"regex,omitempty"`
+	Replace string `json:"replace,omitempty"`
+
+	// RemoveQuery lists the query parameters to remove
+	RemoveQuery []string `json:"removeQuery,omitempty"`
+
+	// AddQuery lists the query parameters to add, replacing any existing values
+	AddQuery map[string]string `json:"addQuery,omitempty"`
+
+	// Scheme replaces the scheme of the URL, e.g. `https`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+type compiledRewrite struct {
+	rewrite *UrlRewrite
+	regex   *regexp.Regexp
+}
+
+func compileRewrite(r *UrlRewrite) (*compiledRewrite, error) {
+	c := &compiledRewrite{rewrite: r}
+
+	if r.Regex != "" {
+		regex, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite: %w", err)
+		}
+		c.regex = regex
+	}
+
+	if r.Scheme != "" && !schemeRegexp.MatchString(r.Scheme) {
+		return nil, fmt.Errorf("rewrite: %w `%s`", ErrInvalidScheme, r.Scheme)
+	}
+
+	return c, nil
+}
+
+// Apply returns the rewritten URL
+func (r *UrlRewrite) Apply(u string) (string, error) {
+	c, err := compileRewrite(r)
+	if err != nil {
+		return u, err
+	}
+
+	return c.apply(u), nil
+}
+
+func (c *compiledRewrite) apply(u string) string {
+	if c.regex != nil {
+		u = c.regex.ReplaceAllString(u, c.rewrite.Replace)
+	}
+
+	if len(c.rewrite.RemoveQuery) == 0 && len(c.rewrite.AddQuery) == 0 && c.rewrite.Scheme == "" {
+		return u
+	}
+
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	if len(c.rewrite.RemoveQuery) > 0 || len(c.rewrite.AddQuery) > 0 {
+		parsed.RawQuery = c.rewriteQuery(parsed.RawQuery)
+	}
+
+	if c.rewrite.Scheme != "" {
+		parsed.Scheme = c.rewrite.Scheme
+	}
+
+	return parsed.String()
+}
+
+// rewriteQuery removes and adds the query parameters, keeping the rest of the query as it was
+func (c *compiledRewrite) rewriteQuery(rawQuery string) string {
+	var params []string
+
+	if rawQuery != "" {
+		for param := range strings.SplitSeq(rawQuery, "&") {
+			key, _, _ := strings.Cut(param, "=")
+			if unescaped, err := url.QueryUnescape(key); err == nil {
+				key = unescaped
+			}
+
+			if _, replaced := c.rewrite.AddQuery[key]; replaced || slices.Contains(c.rewrite.RemoveQuery, key) {
+				continue
+			}
+			params = append(params, param)
+		}
+	}
+
+	keys := make([]string, 0, len(c.rewrite.AddQuery))
+	for key := range c.rewrite.AddQuery {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		params = append(params, url.QueryEscape(key)+"="+url.QueryEscape(c.rewrite.AddQuery[key]))
+	}
+
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,97 @@
+package linkquisition_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestUrlRewrite_Apply(t *testing.T) {
+	for _, tt := range [...]struct {
+		name     string
+		rewrite  UrlRewrite
+		url      string
+		expected string
+	}{
+		{
+			name:     "query parameter is added",
+			rewrite:  UrlRewrite{AddQuery: map[string]string{"authuser": "1"}},
+			url:      "https://mail.google.com/mail/u/0/",
+			expected: "https://mail.google.com/mail/u/0/?authuser=1",
+		},
+		{
+			name:     "added query parameter replaces the existing one and keeps the others in order",
+			rewrite:  UrlRewrite{AddQuery: map[string]string{"authuser": "1"}},
+			url:      "https://docs.google.com/document/d/1?usp=sharing&authuser=0&b=2",
+			expected: "https://docs.google.com/document/d/1?usp=sharing&b=2&authuser=1",
+		},
+		{
+			name:     "query parameters are removed",
+			rewrite:  UrlRewrite{RemoveQuery: []string{"utm_source", "utm_medium"}},
+			url:      "https://example.com/article?id=5&utm_source=news&utm_medium=email#top",
+			expected: "https://example.com/article?id=5#top",
+		},
+		{
+			name:     "regex is substituted with the capture groups",
+			rewrite:  UrlRewrite{Regex: `^https://meet\.google\.com/([a-z-]+)$`, Replace: "https://meet.google.com/$1?pli=1"},
+			url:      "https://meet.google.com/abc-defg-hij",
+			expected: "https://meet.google.com/abc-defg-hij?pli=1",
+		},
+		{
+			name:     "scheme is changed",
+			rewrite:  UrlRewrite{Scheme: "https"},
+			url:      "http://example.com/path?q=1",
+			expected: "https://example.com/path?q=1",
+		},
+		{
+			name:     "the changes are applied in order",
+			rewrite:  UrlRewrite{Regex: `^http://old\.example\.com`, Replace: "http://new.example.com", Scheme: "https"},
+			url:      "http://old.example.com/a",
+			expected: "https://new.example.com/a",
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				rewritten, err := tt.rewrite.Apply(tt.url)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, rewritten)
+			},
+		)
+	}
+}
+
+func TestMatcher_Match_Rewrite(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Chrome (work)",
+				Command: "google-chrome --profile-directory=Work %U",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeDomain, Value: "google.com", Rewrite: &UrlRewrite{AddQuery: map[string]string{"authuser": "1"}}},
+					{Type: BrowserMatchTypeSite, Value: "www.example.com", Rewrite: &UrlRewrite{Scheme: "not a scheme"}},
+					{Type: BrowserMatchTypeSite, Value: "www.example.org", Rewrite: &UrlRewrite{Regex: `(broken`}},
+					{Type: BrowserMatchTypeSite, Value: "www.example.net"},
+				},
+			},
+		},
+	}
+
+	m, err := NewMatcher(settings)
+	assert.ErrorIs(t, err, ErrInvalidScheme)
+	assert.ErrorContains(t, err, "rule #2")
+
+	result, err := m.Match("https://mail.google.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://mail.google.com/?authuser=1", result.Url)
+
+	result, err = m.Match("https://www.example.net/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.net/", result.Url)
+
+	// the rules with invalid rewrites are left out
+	_, err = m.Match("https://www.example.com/")
+	assert.ErrorIs(t, err, ErrNoMatchFound)
+}
@@ -0,0 +1,165 @@
+package linkquisition
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// RuleStat holds the usage statistics of a single browser-rule
+type RuleStat struct {
+	// Browser is the command of the browser the rule belongs to
+	Browser string       `json:"browser"`
+	Rule    BrowserMatch `json:"rule"`
+	Hits    int          `json:"hits"`
+
+	// FirstSeen is when the rule was first noticed in the settings, used as the reference for rules never matched
+	FirstSeen time.Time  `json:"firstSeen"`
+	LastHit   *time.Time `json:"lastHit,omitempty"`
+
+	// Origin is the drop-in file, or the policy, the rule comes from; such a rule can't be removed from the settings
+	Origin string `json:"origin,omitempty"`
+}
+
+// LastUsed returns when the rule last matched, or when it was first seen if it has never matched
+func (s *RuleStat) LastUsed() time.Time {
+	if s.LastHit != nil {
+		return *s.LastHit
+	}
+
+	return s.FirstSeen
+}
+
+// RuleStats holds the usage statistics of the browser-rules
+type RuleStats struct {
+	Rules []RuleStat `json:"rules"`
+}
+
+// RuleStatsReport groups the rules by their usage
+type RuleStatsReport struct {
+	// Hot lists the rules that have matched, the most used first
+	Hot []RuleStat `json:"hot"`
+
+	// NeverMatched lists the rules that have not matched even once
+	NeverMatched []RuleStat `json:"neverMatched"`
+
+	// Unused lists the rules of the user's own that have not matched within the given period, whether they ever matched
+	// or not; the rules of the drop-ins and the policies are left out, as they can't be removed
+	Unused []RuleStat `json:"unused"`
+}
+
+type RuleStatsService interface {
+	// ReadRuleStats reads the statistics from the state-file, returning empty statistics if there's none yet
+	ReadRuleStats() (*RuleStats, error)
+
+	// UpdateRuleStats applies the given update to the statistics of the state-file without losing concurrent updates
+	UpdateRuleStats(update func(stats *RuleStats) error) error
+}
+
+func ruleStatKey(browser string, rule *BrowserMatch) string {
+	// the rules have no identity of their own, so they are identified by their full contents
+	data, _ := json.Marshal(rule)
+
+	return browser + "\x00" + string(data)
+}
+
+func (s *RuleStats) find(browser string, rule *BrowserMatch) *RuleStat {
+	key := ruleStatKey(browser, rule)
+
+	for i := range s.Rules {
+		if ruleStatKey(s.Rules[i].Browser, &s.Rules[i].Rule) == key {
+			return &s.Rules[i]
+		}
+	}
+
+	return nil
+}
+
+// RecordHit records the given rule of the given browser matching at the given time
+func (s *RuleStats) RecordHit(browser *Browser, rule BrowserMatch, at time.Time) {
+	stat := s.find(browser.Command, &rule)
+	if stat == nil {
+		s.Rules = append(s.Rules, RuleStat{Browser: browser.Command, Rule: rule, FirstSeen: at})
+		stat = &s.Rules[len(s.Rules)-1]
+	}
+
+	stat.Hits++
+	stat.LastHit = &at
+}
+
+// Sync makes the statistics follow the rules in the settings: the new rules are marked first seen at the given time
+// and the statistics of the rules no longer present are dropped. The statistics are kept in the order of the rules.
+func (s *RuleStats) Sync(settings *Settings, now time.Time) {
+	existing := make(map[string]int, len(s.Rules))
+	for i := range s.Rules {
+		existing[ruleStatKey(s.Rules[i].Browser, &s.Rules[i].Rule)] = i
+	}
+
+	rules := make([]RuleStat, 0, len(s.Rules))
+
+	for i := range settings.Browsers {
+		browser := &settings.Browsers[i]
+
+		for j := range browser.Matches {
+			stat := RuleStat{Browser: browser.Command, Rule: browser.Matches[j], FirstSeen: now}
+			if k, found := existing[ruleStatKey(browser.Command, &browser.Matches[j])]; found {
+				stat = s.Rules[k]
+			}
+			stat.Origin = browser.Matches[j].Origin
+
+			rules = append(rules, stat)
+		}
+	}
+
+	s.Rules = rules
+}
+
+// Report groups the rules by their usage. Rules which haven't matched since `unusedSince` are reported as unused.
+func (s *RuleStats) Report(unusedSince time.Time) *RuleStatsReport {
+	report := &RuleStatsReport{Hot: []RuleStat{}, NeverMatched: []RuleStat{}, Unused: []RuleStat{}}
+
+	for _, stat := range s.Rules {
+		if stat.Hits > 0 {
+			report.Hot = append(report.Hot, stat)
+		} else {
+			report.NeverMatched = append(report.NeverMatched, stat)
+		}
+
+		if stat.LastUsed().Before(unusedSince) && stat.Origin == "" {
+			report.Unused = append(report.Unused, stat)
+		}
+	}
+
+	slices.SortStableFunc(report.Hot, func(a, b RuleStat) int {
+		return b.Hits - a.Hits
+	})
+
+	return report
+}
+
+// RemoveRules removes the given rules from the settings and returns the number of rules removed. Only the user's own
+// rules are removed: the ones of the drop-ins and the policies would be back on the next read.
+func (s *Settings) RemoveRules(rules []RuleStat) int {
+	remove := map[string]bool{}
+	for i := range rules {
+		remove[ruleStatKey(rules[i].Browser, &rules[i].Rule)] = true
+	}
+
+	removed := 0
+
+	for i := range s.Browsers {
+		browser := &s.Browsers[i]
+
+		browser.Matches = slices.DeleteFunc(browser.Matches, func(match BrowserMatch) bool {
+			if match.Origin == "" && remove[ruleStatKey(browser.Command, &match)] {
+				removed++
+				return true
+			}
+			return false
+		})
+	}
+
+	s.matcher = nil
+
+	return removed
+}
@@ -0,0 +1,135 @@
+package linkquisition_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestRuleStats_Report(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Firefox",
+				Command: "firefox %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "www.example.com"},
+					{Type: BrowserMatchTypeSite, Value: "old.example.com"},
+				},
+			},
+			{
+				Name:    "Chrome",
+				Command: "chrome %U",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeDomain, Value: "google.com"},
+					{Type: BrowserMatchTypeDomain, Value: "never.example.org"},
+				},
+			},
+		},
+	}
+
+	stats := &RuleStats{}
+	stats.Sync(settings, start)
+
+	firefox := &Browser{Name: "Firefox", Command: "firefox %u"}
+	chrome := &Browser{Name: "Chrome", Command: "chrome %U"}
+
+	stats.RecordHit(firefox, settings.Browsers[0].Matches[1], start.Add(1*day))
+	stats.RecordHit(chrome, settings.Browsers[1].Matches[0], start.Add(50*day))
+	stats.RecordHit(firefox, settings.Browsers[0].Matches[0], start.Add(58*day))
+	stats.RecordHit(firefox, settings.Browsers[0].Matches[0], start.Add(59*day))
+
+	// a rule added later is only counted as unused from when it was first seen
+	settings.Browsers[1].Matches = append(settings.Browsers[1].Matches, BrowserMatch{Type: BrowserMatchTypeSite, Value: "new.example.org"})
+	stats.Sync(settings, start.Add(40*day))
+
+	report := stats.Report(start.Add(60 * day).Add(-30 * day))
+
+	values := func(rules []RuleStat) []string {
+		var result []string
+		for _, rule := range rules {
+			result = append(result, rule.Rule.Value)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"www.example.com", "old.example.com", "google.com"}, values(report.Hot))
+	assert.Equal(t, []string{"never.example.org", "new.example.org"}, values(report.NeverMatched))
+	assert.Equal(t, []string{"old.example.com", "never.example.org"}, values(report.Unused))
+
+	assert.Equal(t, 2, report.Hot[0].Hits)
+	assert.Equal(t, start.Add(59*day), *report.Hot[0].LastHit)
+}
+
+func TestRuleStats_Sync_DropsRemovedRules(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{
+				Name:    "Firefox",
+				Command: "firefox %u",
+				Matches: []BrowserMatch{
+					{Type: BrowserMatchTypeSite, Value: "www.example.com"},
+					{Type: BrowserMatchTypeSite, Value: "www.example.org"},
+				},
+			},
+		},
+	}
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	stats := &RuleStats{}
+	stats.Sync(settings, now)
+	stats.RecordHit(&Browser{Command: "firefox %u"}, settings.Browsers[0].Matches[1], now)
+
+	removed := settings.RemoveRules(stats.Rules[:1])
+	require.Equal(t, 1, removed)
+	require.Len(t, settings.Browsers[0].Matches, 1)
+
+	stats.Sync(settings, now)
+
+	require.Len(t, stats.Rules, 1)
+	assert.Equal(t, "www.example.org", stats.Rules[0].Rule.Value)
+	assert.Equal(t, 1, stats.Rules[0].Hits)
+
+	browser, err := settings.GetMatchingBrowser("https://www.example.com")
+	assert.Nil(t, browser)
+	assert.ErrorIs(t, err, ErrNoMatchFound)
+}
+
+func TestRuleStats_DropInRulesAreNotPruned(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "www.example.com"}}},
+		},
+	}
+	settings.MergeDropIn(
+		&Settings{
+			Browsers: []BrowserSettings{
+				{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "corp.example"}}},
+			},
+		},
+		"/home/user/.config/linkquisition/config.d/10-team.json",
+	)
+
+	stats := &RuleStats{}
+	stats.Sync(settings, now)
+
+	report := stats.Report(now.Add(time.Hour))
+	require.Len(t, report.NeverMatched, 2)
+	require.Len(t, report.Unused, 1)
+	assert.Equal(t, "www.example.com", report.Unused[0].Rule.Value)
+
+	// even if asked to, the rules of the drop-in are left in place
+	assert.Equal(t, 1, settings.RemoveRules(stats.Rules))
+	require.Len(t, settings.Browsers[0].Matches, 1)
+	assert.Equal(t, "corp.example", settings.Browsers[0].Matches[0].Value)
+}
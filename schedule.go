@@ -0,0 +1,165 @@
+package linkquisition
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Clock provides the current time for the time-window conditions of the rules
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is an adapter to allow the use of an ordinary function as a Clock
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the Clock returning the actual current time
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+var ErrInvalidWeekday = errors.New("invalid weekday")
+var ErrInvalidTimeRange = errors.New("invalid time range, expected e.g. `09:00-17:00`")
+
+// Schedule limits a rule to certain days of the week and times of the day
+type Schedule struct {
+	// Days lists the weekdays (e.g. `mon`, `tuesday`) or ranges of them (e.g. `mon-fri`); empty means every day
+	Days []string `json:"days,omitempty"`
+
+	// Hours lists the time ranges (e.g. `09:00-17:00`) within the days; empty means the whole day. A range ending
+	// before it starts (e.g. `22:00-06:00`) continues past the midnight.
+	Hours []string `json:"hours,omitempty"`
+
+	// Timezone is the IANA name of the timezone (e.g. `Europe/Helsinki`) the days and hours are in; defaults to the
+	// local timezone
+	Timezone string `json:"timezone,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+const minutesPerDay = 24 * 60
+
+type minuteRange struct {
+	from, to int
+}
+
+// compiledSchedule is a Schedule with its days, hours and timezone parsed
+type compiledSchedule struct {
+	days     [7]bool
+	ranges   []minuteRange
+	location *time.Location
+}
+
+func compileSchedule(s *Schedule) (*compiledSchedule, error) {
+	c := &compiledSchedule{location: time.Local}
+
+	if s.Timezone != "" {
+		location, err := time.LoadLocation(s.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		c.location = location
+	}
+
+	if len(s.Days) == 0 {
+		c.days = [7]bool{true, true, true, true, true, true, true}
+	}
+
+	for _, day := range s.Days {
+		first, last, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(day)), "-")
+		if !isRange {
+			last = first
+		}
+
+		from, okFrom := weekdays[strings.TrimSpace(first)]
+		to, okTo := weekdays[strings.TrimSpace(last)]
+		if !okFrom || !okTo {
+			return nil, fmt.Errorf("%w: `%s`", ErrInvalidWeekday, day)
+		}
+
+		for d := from; ; d = (d + 1) % 7 {
+			c.days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+
+	for _, hours := range s.Hours {
+		from, to, found := strings.Cut(hours, "-")
+		if !found {
+			return nil, fmt.Errorf("%w: `%s`", ErrInvalidTimeRange, hours)
+		}
+
+		fromMinutes, errFrom := parseTimeOfDay(from)
+		toMinutes, errTo := parseTimeOfDay(to)
+		if errFrom != nil || errTo != nil {
+			return nil, fmt.Errorf("%w: `%s`", ErrInvalidTimeRange, hours)
+		}
+
+		c.ranges = append(c.ranges, minuteRange{from: fromMinutes, to: toMinutes})
+	}
+
+	return c, nil
+}
+
+// parseTimeOfDay returns the minutes since the midnight for a time such as `09:30`; `24:00` is allowed as the end of day
+func parseTimeOfDay(value string) (int, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(strings.TrimSpace(value), "%d:%d", &hours, &minutes); err != nil {
+		return 0, err
+	}
+
+	total := hours*60 + minutes
+	if hours < 0 || minutes < 0 || minutes >= 60 || total > minutesPerDay {
+		return 0, ErrInvalidTimeRange
+	}
+
+	return total, nil
+}
+
+func (c *compiledSchedule) matches(now time.Time) bool {
+	now = now.In(c.location)
+	minute := now.Hour()*60 + now.Minute()
+
+	if len(c.ranges) == 0 {
+		return c.days[now.Weekday()]
+	}
+
+	for _, r := range c.ranges {
+		switch {
+		case r.from <= r.to:
+			if c.days[now.Weekday()] && minute >= r.from && minute < r.to {
+				return true
+			}
+		case minute >= r.from:
+			// the range continues past the midnight; this is the part before the midnight
+			if c.days[now.Weekday()] {
+				return true
+			}
+		case minute < r.to:
+			// ...and this is the part after the midnight, which belongs to the range starting on the previous day
+			if c.days[(now.Weekday()+6)%7] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,141 @@
+package linkquisition_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestSettings_GetMatchingBrowser_Schedule(t *testing.T) {
+	// 2024-01-15 is a Monday
+	at := func(value string) Clock {
+		return ClockFunc(func() time.Time {
+			parsed, err := time.Parse(time.RFC3339, value)
+			require.NoError(t, err)
+			return parsed
+		})
+	}
+
+	for _, tt := range [...]struct {
+		name     string
+		when     Schedule
+		clock    Clock
+		expected bool
+	}{
+		{
+			name:     "matches within the working hours",
+			when:     Schedule{Days: []string{"mon-fri"}, Hours: []string{"09:00-17:00"}, Timezone: "UTC"},
+			clock:    at("2024-01-15T10:30:00Z"),
+			expected: true,
+		},
+		{
+			name:     "does not match before the working hours",
+			when:     Schedule{Days: []string{"mon-fri"}, Hours: []string{"09:00-17:00"}, Timezone: "UTC"},
+			clock:    at("2024-01-15T08:59:00Z"),
+			expected: false,
+		},
+		{
+			name:     "does not match at the end of the working hours",
+			when:     Schedule{Days: []string{"mon-fri"}, Hours: []string{"09:00-17:00"}, Timezone: "UTC"},
+			clock:    at("2024-01-15T17:00:00Z"),
+			expected: false,
+		},
+		{
+			name:     "does not match on the weekend",
+			when:     Schedule{Days: []string{"mon-fri"}, Hours: []string{"09:00-17:00"}, Timezone: "UTC"},
+			clock:    at("2024-01-13T10:30:00Z"),
+			expected: false,
+		},
+		{
+			name:     "several time ranges are supported",
+			when:     Schedule{Hours: []string{"08:00-11:30", "12:30-16:00"}, Timezone: "UTC"},
+			clock:    at("2024-01-15T13:00:00Z"),
+			expected: true,
+		},
+		{
+			name:     "the gap between the time ranges does not match",
+			when:     Schedule{Hours: []string{"08:00-11:30", "12:30-16:00"}, Timezone: "UTC"},
+			clock:    at("2024-01-15T12:00:00Z"),
+			expected: false,
+		},
+		{
+			name:     "the hours are evaluated in the given timezone",
+			when:     Schedule{Days: []string{"mon"}, Hours: []string{"09:00-17:00"}, Timezone: "Europe/Helsinki"},
+			clock:    at("2024-01-15T07:30:00Z"),
+			expected: true,
+		},
+		{
+			name:     "a range past the midnight matches after the midnight of the following day",
+			when:     Schedule{Days: []string{"fri"}, Hours: []string{"22:00-06:00"}, Timezone: "UTC"},
+			clock:    at("2024-01-13T02:00:00Z"),
+			expected: true,
+		},
+		{
+			name:     "a range past the midnight does not match after the midnight of the wrong day",
+			when:     Schedule{Days: []string{"fri"}, Hours: []string{"22:00-06:00"}, Timezone: "UTC"},
+			clock:    at("2024-01-12T02:00:00Z"),
+			expected: false,
+		},
+		{
+			name:     "days without hours match the whole day",
+			when:     Schedule{Days: []string{"Saturday", "sun"}, Timezone: "UTC"},
+			clock:    at("2024-01-14T23:59:00Z"),
+			expected: true,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				when := tt.when
+				settings := &Settings{
+					Browsers: []BrowserSettings{
+						{
+							Name:    "Work",
+							Command: "firefox -P work %u",
+							Matches: []BrowserMatch{
+								{Type: BrowserMatchTypeDomain, Value: "slack.com", When: &when},
+							},
+						},
+					},
+					Environment: MatchEnvironment{Clock: tt.clock},
+				}
+
+				_, compileErr := settings.GetMatcher()
+				require.NoError(t, compileErr)
+
+				browser, err := settings.GetMatchingBrowser("https://acme.slack.com/archives/C123")
+				if tt.expected {
+					require.NoError(t, err)
+					assert.Equal(t, "Work", browser.Name)
+				} else {
+					assert.ErrorIs(t, err, ErrNoMatchFound)
+				}
+			},
+		)
+	}
+}
+
+func TestNewMatcher_ReportsInvalidSchedules(t *testing.T) {
+	for _, when := range []Schedule{
+		{Days: []string{"someday"}},
+		{Hours: []string{"9-17"}},
+		{Hours: []string{"09:00-25:00"}},
+		{Timezone: "Nowhere/Special"},
+	} {
+		settings := &Settings{
+			Browsers: []BrowserSettings{
+				{
+					Name:    "Work",
+					Command: "firefox -P work %u",
+					Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "slack.com", When: &when}},
+				},
+			},
+		}
+
+		_, err := NewMatcher(settings)
+		assert.Error(t, err, "schedule %+v", when)
+	}
+}
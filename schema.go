@@ -0,0 +1,201 @@
+package linkquisition
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SettingsSchemaDraft is the JSON Schema -draft the schemas are written in; draft-07 is the one best supported by editors
+const SettingsSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// SchemaProvider is an optional interface for plugins to describe their `settings` -block with a JSON Schema, which is
+// then included in the schema of the config-file. The schema has to be self-contained, i.e. without any references.
+type SchemaProvider interface {
+	GetSettingsSchema() map[string]any
+}
+
+// schemaKeywords holds the keywords that can't be derived from the types, keyed by the type and the JSON-name of the
+// field
+var schemaKeywords = map[string]map[string]any{
+	"Settings.version":    {"minimum": 0, "maximum": SettingsVersion},
+	"Settings.logLevel":   {"enum": []string{"debug", "info", "warn", "error"}},
+	"Settings.resolution": {"enum": []string{ResolutionOrder, ResolutionMostSpecific}},
+	"BrowserSettings.source": {
+		"enum": []string{SourceAuto, SourceManual},
+	},
+	"BrowserMatch.type": {
+		"enum": []string{
+			BrowserMatchTypeRegex, BrowserMatchTypeDomain, BrowserMatchTypeSite, BrowserMatchTypeGlob,
+			BrowserMatchTypeHostSuffix, BrowserMatchTypePathPrefix, BrowserMatchTypeQuery, BrowserMatchTypeSourceApp,
+			BrowserMatchTypeNetworkInterface, BrowserMatchTypeNetworkCidr, BrowserMatchTypeDnsSearchDomain,
+		},
+	},
+	"BrowserMatch.publicSuffixes": {"enum": []string{PublicSuffixesPrivate, PublicSuffixesIcann}},
+	"Rule.action": {
+		"enum": []string{RuleActionOpen, RuleActionBlock, RuleActionAsk, RuleActionCopy, RuleActionSystemDefault},
+	},
+}
+
+// GetSettingsSchema returns the JSON Schema of the config-file. The schemas of the plugins' settings are given keyed by
+// the path of the plugin, as it's written in the config-file.
+func GetSettingsSchema(pluginSchemas map[string]map[string]any) map[string]any {
+	g := &schemaGenerator{
+		definitions:   map[string]any{},
+		visiting:      map[reflect.Type]bool{},
+		pluginSchemas: pluginSchemas,
+	}
+
+	schema := g.schemaOf(reflect.TypeFor[Settings]())
+	schema["$schema"] = SettingsSchemaDraft
+	schema["title"] = "Linkquisition config-file"
+
+	if len(g.definitions) > 0 {
+		schema["definitions"] = g.definitions
+	}
+
+	return schema
+}
+
+// GenerateSchema returns a self-contained JSON Schema for the type of the given value, which is meant for the plugins
+// implementing SchemaProvider. The JSON-names of the fields are taken from their `json` -tags.
+func GenerateSchema(v any) map[string]any {
+	g := &schemaGenerator{definitions: map[string]any{}, visiting: map[reflect.Type]bool{}}
+
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+type schemaGenerator struct {
+	// definitions holds the schemas of the recursive types, which are referred to rather than inlined
+	definitions map[string]any
+	visiting    map[reflect.Type]bool
+
+	pluginSchemas map[string]map[string]any
+}
+
+func (g *schemaGenerator) schemaOf(t reflect.Type) map[string]any {
+	if t == reflect.TypeFor[time.Time]() {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaOf(t.Elem())
+	case reflect.Struct:
+		return g.structSchema(t)
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaOf(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		// any value goes, e.g. for `any`
+		return map[string]any{}
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	ref := map[string]any{"$ref": "#/definitions/" + t.Name()}
+
+	if _, defined := g.definitions[t.Name()]; defined {
+		return ref
+	}
+
+	if g.visiting[t] {
+		// the type refers to itself: the schema is stored as a definition once it's complete
+		g.definitions[t.Name()] = nil
+		return ref
+	}
+
+	g.visiting[t] = true
+	defer delete(g.visiting, t)
+
+	properties := map[string]any{}
+	g.addProperties(t, properties)
+
+	schema := map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+
+	if t == reflect.TypeFor[PluginSettings]() {
+		g.addPluginSchemas(schema)
+	}
+
+	if _, recursive := g.definitions[t.Name()]; recursive {
+		g.definitions[t.Name()] = schema
+		return ref
+	}
+
+	return schema
+}
+
+// addProperties adds the schemas of the fields of the struct to the properties, flattening the embedded structs just
+// like encoding/json does
+func (g *schemaGenerator) addProperties(t reflect.Type, properties map[string]any) {
+	for _, field := range reflect.VisibleFields(t) {
+		if len(field.Index) > 1 || !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous && tag == "" {
+			g.addProperties(field.Type, properties)
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schemaOf(field.Type)
+		maps.Copy(property, schemaKeywords[t.Name()+"."+name])
+
+		// encoding/json writes the nil slices, maps and pointers as null unless they're omitted
+		switch field.Type.Kind() {
+		case reflect.Slice, reflect.Map, reflect.Pointer:
+			if propertyType, ok := property["type"].(string); ok && !slices.Contains(strings.Split(options, ","), "omitempty") {
+				property["type"] = []string{propertyType, "null"}
+			}
+		}
+
+		properties[name] = property
+	}
+}
+
+// addPluginSchemas applies the schema of each plugin to the `settings` of the plugin with the same path
+func (g *schemaGenerator) addPluginSchemas(schema map[string]any) {
+	var conditions []any
+
+	for _, path := range slices.Sorted(maps.Keys(g.pluginSchemas)) {
+		conditions = append(conditions, map[string]any{
+			"if": map[string]any{
+				"properties": map[string]any{"path": map[string]any{"const": path}},
+				"required":   []string{"path"},
+			},
+			"then": map[string]any{
+				"properties": map[string]any{"settings": g.pluginSchemas[path]},
+			},
+		})
+	}
+
+	if len(conditions) > 0 {
+		schema["allOf"] = conditions
+	}
+}
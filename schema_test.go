@@ -0,0 +1,105 @@
+package linkquisition_test
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestGetSettingsSchema(t *testing.T) {
+	pluginSchema := map[string]any{"type": "object", "properties": map[string]any{"maxRedirects": map[string]any{"type": "integer"}}}
+
+	data, err := json.Marshal(GetSettingsSchema(map[string]map[string]any{"terminus.so": pluginSchema}))
+	require.NoError(t, err)
+
+	// the schema is compared in its JSON-form, just like the editors see it
+	var schema struct {
+		Schema      string         `json:"$schema"`
+		Properties  map[string]any `json:"properties"`
+		Definitions map[string]struct {
+			Properties map[string]struct {
+				Enum []string `json:"enum"`
+			} `json:"properties"`
+		} `json:"definitions"`
+	}
+	require.NoError(t, json.Unmarshal(data, &schema))
+
+	assert.Equal(t, SettingsSchemaDraft, schema.Schema)
+	assert.ElementsMatch(
+		t,
+		[]string{
+			"$schema", "version", "logLevel", "browsers", "plugins", "ui", "rules", "modes", "activeMode", "resolution",
+			"subscriptions",
+		},
+		slices.Collect(maps.Keys(schema.Properties)),
+	)
+
+	// the rules refer to themselves through `all` and `not`, so they're defined once and referred to
+	assert.Contains(t, schema.Definitions["BrowserMatch"].Properties["type"].Enum, BrowserMatchTypeHostSuffix)
+
+	browsers := schema.Properties["browsers"].(map[string]any)
+	assert.Equal(t, []any{"array", "null"}, browsers["type"])
+
+	plugins := schema.Properties["plugins"].(map[string]any)["items"].(map[string]any)
+	assert.JSONEq(
+		t,
+		`[{
+			"if": {"properties": {"path": {"const": "terminus.so"}}, "required": ["path"]},
+			"then": {"properties": {"settings": {"type": "object", "properties": {"maxRedirects": {"type": "integer"}}}}}
+		}]`,
+		mustMarshal(t, plugins["allOf"]),
+	)
+}
+
+func TestGenerateSchema(t *testing.T) {
+	type nested struct {
+		Parameter string `json:"parameter"`
+	}
+
+	type pluginSettings struct {
+		Rules    []nested          `json:"rules"`
+		Enabled  bool              `json:"enabled,omitempty"`
+		Timeout  string            `json:"timeout,omitempty"`
+		Limit    int               `json:"limit"`
+		Headers  map[string]string `json:"headers,omitempty"`
+		internal string
+	}
+
+	assert.JSONEq(
+		t,
+		`{
+			"type": "object",
+			"additionalProperties": false,
+			"properties": {
+				"rules": {
+					"type": ["array", "null"],
+					"items": {
+						"type": "object",
+						"additionalProperties": false,
+						"properties": {"parameter": {"type": "string"}}
+					}
+				},
+				"enabled": {"type": "boolean"},
+				"timeout": {"type": "string"},
+				"limit": {"type": "integer"},
+				"headers": {"type": "object", "additionalProperties": {"type": "string"}}
+			}
+		}`,
+		mustMarshal(t, GenerateSchema(pluginSettings{internal: "unused"})),
+	)
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	return string(data)
+}
@@ -2,25 +2,170 @@ package linkquisition
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
-	"regexp"
+	"maps"
+	"slices"
 	"strings"
+	"time"
 )
 
 var ErrNoMatchFound = errors.New("no match found")
+var ErrNoBrowserAction = errors.New("the matching rule does not open a browser")
 
 const (
 	BrowserMatchTypeRegex  = "regex"
 	BrowserMatchTypeDomain = "domain"
 	BrowserMatchTypeSite   = "site"
+	BrowserMatchTypeGlob   = "glob"
+
+	// BrowserMatchTypeHostSuffix matches the host and all of its subdomains, e.g. `corp.example.com` matches
+	// `wiki.corp.example.com` but not `example.com`
+	BrowserMatchTypeHostSuffix = "hostSuffix"
+
+	BrowserMatchTypePathPrefix = "pathPrefix"
+	BrowserMatchTypeQuery      = "query"
+	BrowserMatchTypeSourceApp  = "sourceApp"
+
+	BrowserMatchTypeNetworkInterface = "networkInterface"
+	BrowserMatchTypeNetworkCidr      = "networkCidr"
+	BrowserMatchTypeDnsSearchDomain  = "dnsSearchDomain"
 
 	SourceAuto   = "auto"
 	SourceManual = "manual"
+
+	// RuleActionOpen opens the URL with the browser of the rule
+	RuleActionOpen = "open"
+	// RuleActionBlock refuses to open the URL, e.g. for known phishing- or tracking-domains
+	RuleActionBlock = "block"
+	// RuleActionAsk always shows the picker, even if another rule matches as well
+	RuleActionAsk = "ask"
+	// RuleActionCopy copies the URL to the clipboard instead of opening it
+	RuleActionCopy = "copy"
+	// RuleActionSystemDefault opens the URL with the default browser of the system
+	RuleActionSystemDefault = "system-default"
+
+	// ResolutionOrder picks the first browser (in the order of the settings) with a matching rule
+	ResolutionOrder = "order"
+	// ResolutionMostSpecific picks the browser with the most specific matching rule (regex or path over site over domain)
+	ResolutionMostSpecific = "mostSpecific"
 )
 
+// The public suffixes of BrowserMatch.PublicSuffixes
+const (
+	// PublicSuffixesPrivate derives the domain of a host using both the ICANN and the private public suffixes, so that
+	// e.g. each `*.github.io` site is a domain of its own
+	PublicSuffixesPrivate = "private"
+	// PublicSuffixesIcann derives the domain of a host using only the ICANN public suffixes, so that e.g. every
+	// `*.github.io` site belongs to the domain `github.io`
+	PublicSuffixesIcann = "icann"
+)
+
+// Rule specificities used by the most-specific -resolution mode
+const (
+	SpecificityDomain = iota + 1
+	SpecificityHostSuffix
+	SpecificitySite
+	SpecificityPath
+)
+
+// BrowserMatch is a single browser-rule. Besides its own type and value it may have further conditions in `All`, which
+// all have to match as well, and exclusions in `Not`, none of which may match. The type may be left empty when the
+// conditions are given in `All`.
 type BrowserMatch struct {
-	Type  string `json:"type"`
-	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+	Value string `json:"value,omitempty"`
+
+	All []BrowserMatch `json:"all,omitempty"`
+	Not []BrowserMatch `json:"not,omitempty"`
+
+	// PublicSuffixes is how the domain of a `domain` -rule is derived: PublicSuffixesPrivate (the default) or
+	// PublicSuffixesIcann
+	PublicSuffixes string `json:"publicSuffixes,omitempty"`
+
+	// Priority lets a rule win over the other matching rules regardless of the order or specificity; the higher wins
+	Priority int `json:"priority,omitempty"`
+
+	// When limits the rule to the given days and hours
+	When *Schedule `json:"when,omitempty"`
+
+	// ExpiresAt makes the rule temporary: it's ignored from the given time on and eventually removed from the settings
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// Rewrite changes the URL before it's opened when the rule matches; it has no effect on the sub-conditions
+	Rewrite *UrlRewrite `json:"rewrite,omitempty"`
+
+	// Origin is the drop-in file, or the policy, the rule comes from; empty for the rules of the user's own config-file
+	Origin string `json:"-"`
+
+	// Locked is set for the rules of a policy, which win over every rule that isn't locked
+	Locked bool `json:"-"`
+
+	// Subscribed is set for the rules of a subscription, which lose to every rule that isn't subscribed
+	Subscribed bool `json:"-"`
+}
+
+// Specificity returns how precisely the rule targets URLs: rules looking at the path (or the whole URL) are more specific
+// than the ones looking at the host, which in turn are more specific than the ones looking at the domain. Compound rules
+// are as specific as their most specific condition.
+func (m *BrowserMatch) Specificity() int {
+	specificity := 0
+
+	switch m.Type {
+	case BrowserMatchTypeRegex, BrowserMatchTypePathPrefix, BrowserMatchTypeQuery:
+		specificity = SpecificityPath
+	case BrowserMatchTypeGlob:
+		specificity = SpecificitySite
+		if strings.Contains(m.Value, "/") {
+			specificity = SpecificityPath
+		}
+	case BrowserMatchTypeSite:
+		specificity = SpecificitySite
+	case BrowserMatchTypeHostSuffix:
+		specificity = SpecificityHostSuffix
+	case BrowserMatchTypeDomain:
+		specificity = SpecificityDomain
+	}
+
+	for i := range m.All {
+		specificity = max(specificity, m.All[i].Specificity())
+	}
+
+	return specificity
+}
+
+// isPlain returns true if the rule has no other conditions besides its own type and value
+func (m *BrowserMatch) isPlain() bool {
+	return len(m.All) == 0 && len(m.Not) == 0 && m.When == nil && m.ExpiresAt == nil
+}
+
+// IsExpired returns true if the rule is temporary and has expired by the given time
+func (m *BrowserMatch) IsExpired(now time.Time) bool {
+	return m.ExpiresAt != nil && !now.Before(*m.ExpiresAt)
+}
+
+// Rule is a top-level rule which, rather than belonging to a browser, triggers an action for the matching URLs
+type Rule struct {
+	BrowserMatch
+
+	// Action is one of the RuleAction* -constants
+	Action string `json:"action"`
+
+	// Browser is the name (or the command) of the browser to open the URL with when the action is RuleActionOpen
+	Browser string `json:"browser,omitempty"`
+
+	// Role is the role of the browser to open the URL with, in place of Browser, see BrowserSettings.Roles; meant for
+	// the rules shared between users having different browsers
+	Role string `json:"role,omitempty"`
+}
+
+// Mode is a named set of top-level rules which are only in effect while the mode is active, e.g. for a client
+type Mode struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Origin is the drop-in file the mode comes from; empty for the modes of the user's own config-file
+	Origin string `json:"-"`
 }
 
 type BrowserSettings struct {
@@ -30,42 +175,50 @@ type BrowserSettings struct {
 	Source  string `json:"source"`
 
 	Matches []BrowserMatch `json:"matches"`
+
+	// Roles are the roles the browser plays, e.g. `work`, for the rules opening the URLs with a role rather than with a
+	// browser by name
+	Roles []string `json:"roles,omitempty"`
+
+	// Origin is the drop-in file, or the policy, the browser comes from; empty for the browsers of the user's own config-file
+	Origin string `json:"-"`
+
+	// matcher holds the rules compiled from matcherMatches, for as long as they are the rules of the browser
+	matcher        *Matcher
+	matcherMatches []BrowserMatch
 }
 
-// MatchesUrl returns true if the given url matches any of the browser's rules
+// MatchesUrl returns true if the given url matches any of the browser's rules. The rules are compiled on the first call
+// and again only once they've been replaced, added or removed.
 func (s *BrowserSettings) MatchesUrl(u string) bool {
-	uu := NewURL(u)
+	if s.matcher == nil || !isSameSlice(s.matcherMatches, s.Matches) {
+		s.matcher, _ = NewMatcher(&Settings{Browsers: []BrowserSettings{{Name: s.Name, Command: s.Command, Matches: s.Matches}}})
+		s.matcherMatches = s.Matches
+	}
 
-	matchSite := func(u, site string) bool {
-		re := regexp.MustCompile(`^https?://([^/]+)(/|$)`)
-		match := re.FindStringSubmatch(u)
-		if len(match) > 1 {
-			return strings.EqualFold(match[1], site)
-		}
+	_, err := s.matcher.Match(u)
 
-		return false
-	}
+	return err == nil
+}
 
-	for i := range s.Matches {
-		switch s.Matches[i].Type {
-		case BrowserMatchTypeRegex:
-			if matches, _ := regexp.MatchString(s.Matches[i].Value, u); matches {
-				return true
-			}
-		case BrowserMatchTypeDomain:
-			if domain, err := uu.GetDomain(); err == nil {
-				if strings.EqualFold(domain, s.Matches[i].Value) {
-					return true
-				}
-			}
-		case BrowserMatchTypeSite:
-			if matchSite(u, s.Matches[i].Value) {
-				return true
-			}
-		}
+// MatchEnvironment holds the circumstances, besides the URL itself, that the rules may depend on
+type MatchEnvironment struct {
+	// Clock is used for the time-window conditions of the rules; defaults to the system clock
+	Clock Clock
+
+	// SourceApp is the application the link was opened from, if known
+	SourceApp *SourceApp
+
+	// Network is used for the network-conditions of the rules; without it those conditions never match
+	Network NetworkProbe
+}
+
+func (e *MatchEnvironment) now() time.Time {
+	if e.Clock == nil {
+		return time.Now()
 	}
 
-	return false
+	return e.Clock.Now()
 }
 
 type PluginSettings struct {
@@ -76,6 +229,13 @@ type PluginSettings struct {
 	IsDisabled bool `json:"isDisabled"`
 
 	Settings map[string]any `json:"settings,omitempty"`
+
+	// Origin is the drop-in file, or the policy, the plugin comes from; empty for the plugins of the user's own
+	// config-file
+	Origin string `json:"-"`
+
+	// Locked is set for the plugins of a policy, which the user can't change
+	Locked bool `json:"-"`
 }
 
 type UiSettings struct {
@@ -83,10 +243,76 @@ type UiSettings struct {
 }
 
 type Settings struct {
+	// Schema points editors to the JSON Schema of the config-file
+	Schema string `json:"$schema,omitempty"`
+
+	// Version is the version of the config-file format, see SettingsVersion
+	Version int `json:"version"`
+
 	LogLevel string            `json:"logLevel,omitempty"`
 	Browsers []BrowserSettings `json:"browsers"`
 	Plugins  []PluginSettings  `json:"plugins,omitempty"`
 	Ui       UiSettings        `json:"ui"`
+
+	// Rules are the top-level rules, which are evaluated along with the browser-rules; when the rules are resolved in
+	// the order of the settings, the top-level rules come first
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Modes are the named sets of rules to switch between; the rules of the active mode come before the global rules
+	Modes      []Mode `json:"modes,omitempty"`
+	ActiveMode string `json:"activeMode,omitempty"`
+
+	// Resolution decides which browser wins when several have a matching rule: either ResolutionOrder (the default)
+	// or ResolutionMostSpecific
+	Resolution string `json:"resolution,omitempty"`
+
+	// Subscriptions are the shared files of rules whose rules are merged, read-only, losing to the user's own
+	Subscriptions []Subscription `json:"subscriptions,omitempty"`
+
+	// Environment holds the circumstances the rules are matched in; it is not part of the config-file
+	Environment MatchEnvironment `json:"-"`
+
+	matcher       *Matcher
+	matcherErr    error
+	matcherSource matcherSource
+
+	// inherited holds the single values merged from the drop-ins
+	inherited inheritedValues
+
+	// overriddenPlugins holds the user's own plugins replaced by a policy, keyed by the path
+	overriddenPlugins map[string]PluginSettings
+}
+
+// Clone returns a copy of the settings whose browsers, rules, modes and plugins can be added, removed and replaced
+// without affecting the original
+func (s *Settings) Clone() *Settings {
+	clone := *s
+	clone.matcher = nil
+	clone.matcherErr = nil
+
+	clone.Browsers = slices.Clone(s.Browsers)
+	for i := range clone.Browsers {
+		clone.Browsers[i].Matches = slices.Clone(clone.Browsers[i].Matches)
+		clone.Browsers[i].Roles = slices.Clone(clone.Browsers[i].Roles)
+	}
+
+	clone.Rules = slices.Clone(s.Rules)
+
+	clone.Modes = slices.Clone(s.Modes)
+	for i := range clone.Modes {
+		clone.Modes[i].Rules = slices.Clone(clone.Modes[i].Rules)
+	}
+
+	clone.Plugins = slices.Clone(s.Plugins)
+	for i := range clone.Plugins {
+		clone.Plugins[i].Settings = maps.Clone(clone.Plugins[i].Settings)
+	}
+
+	clone.Subscriptions = slices.Clone(s.Subscriptions)
+
+	clone.overriddenPlugins = maps.Clone(s.overriddenPlugins)
+
+	return &clone
 }
 
 // NormalizeBrowsers moves hidden browsers to the end of the list
@@ -102,14 +328,21 @@ func (s *Settings) NormalizeBrowsers() *Settings {
 		}
 	}
 
-	var normalizedSettings = &Settings{
-		Browsers: []BrowserSettings{},
-	}
+	browsers := []BrowserSettings{}
+	browsers = append(browsers, visibleBrowsers...)
+	browsers = append(browsers, hiddenBrowsers...)
 
-	normalizedSettings.Browsers = append(normalizedSettings.Browsers, visibleBrowsers...)
-	normalizedSettings.Browsers = append(normalizedSettings.Browsers, hiddenBrowsers...)
+	return s.withBrowsers(browsers)
+}
+
+// withBrowsers returns a copy of the settings with the browsers replaced
+func (s *Settings) withBrowsers(browsers []BrowserSettings) *Settings {
+	settings := *s
+	settings.Browsers = browsers
+	settings.matcher = nil
+	settings.matcherErr = nil
 
-	return normalizedSettings
+	return &settings
 }
 
 func (s *Settings) UpdateWithBrowsers(browsers []Browser) *Settings {
@@ -133,9 +366,7 @@ func (s *Settings) dropAutoAddedBrowsersNoLongerPresent(browsers []Browser) *Set
 		}
 	}
 
-	return &Settings{
-		Browsers: browserSettings,
-	}
+	return s.withBrowsers(browserSettings)
 }
 
 func (s *Settings) addMissingBrowsers(browsers []Browser) *Settings {
@@ -162,9 +393,7 @@ func (s *Settings) addMissingBrowsers(browsers []Browser) *Settings {
 		}
 	}
 
-	return &Settings{
-		Browsers: browserSettings,
-	}
+	return s.withBrowsers(browserSettings)
 }
 
 func (s *Settings) GetSelectableBrowsers() []Browser {
@@ -185,31 +414,115 @@ func (s *Settings) GetSelectableBrowsers() []Browser {
 	return browsers
 }
 
-func (s *Settings) GetMatchingBrowser(u string) (*Browser, error) {
-	for i := range s.Browsers {
-		if s.Browsers[i].MatchesUrl(u) {
-			return &Browser{
-				Name:    s.Browsers[i].Name,
-				Command: s.Browsers[i].Command,
-			}, nil
+// GetMatcher returns the compiled browser-rules, compiling them on the first call. The rules are compiled again after
+// they've been changed through the methods of Settings, or replaced, added or removed directly. The returned error
+// lists the rules which could not be compiled and are therefore never matched.
+func (s *Settings) GetMatcher() (*Matcher, error) {
+	source := newMatcherSource(s)
+	if s.matcher == nil || !s.matcherSource.isSame(&source) {
+		s.matcher, s.matcherErr = NewMatcher(s)
+		s.matcherSource = source
+	}
+
+	return s.matcher, s.matcherErr
+}
+
+// GetActiveMode returns the active mode, or nil if there's none (or it doesn't exist)
+func (s *Settings) GetActiveMode() *Mode {
+	if s.ActiveMode == "" {
+		return nil
+	}
+
+	for i := range s.Modes {
+		if s.Modes[i].Name == s.ActiveMode {
+			return &s.Modes[i]
 		}
 	}
 
-	return nil, ErrNoMatchFound
+	return nil
+}
+
+// SetActiveMode activates the mode with the given name, or deactivates the modes if the name is empty. The chosen mode
+// is the user's own even if a drop-in activates the same one, whereas a mode activated by a drop-in can only be
+// deactivated in the drop-in.
+func (s *Settings) SetActiveMode(name string) error {
+	if name != "" && !slices.ContainsFunc(s.Modes, func(mode Mode) bool { return mode.Name == name }) {
+		return fmt.Errorf("%w `%s`", ErrUnknownMode, name)
+	}
+
+	if name == "" && s.inherited.activeMode.origin != "" {
+		return fmt.Errorf(
+			"%w: the mode `%s` is activated by the drop-in `%s`, deactivate it there instead",
+			ErrDropInValue, s.inherited.activeMode.value, s.inherited.activeMode.origin,
+		)
+	}
+
+	s.ActiveMode = name
+	s.inherited.activeMode = inheritedValue{}
+	s.matcher = nil
+
+	return nil
+}
+
+// GetMatchingBrowser returns the browser to open the given URL with. ErrNoBrowserAction is returned if the best
+// matching rule is a top-level rule with some other action than opening a browser.
+func (s *Settings) GetMatchingBrowser(u string) (*Browser, error) {
+	m, _ := s.GetMatcher()
+
+	result, err := m.Match(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Action != RuleActionOpen {
+		return nil, fmt.Errorf("%w: %s", ErrNoBrowserAction, result.Action)
+	}
+
+	return &result.Browser, nil
 }
 
 func (s *Settings) AddRuleToBrowser(b *Browser, matchType, matchValue string) {
+	s.AddMatchToBrowser(b, BrowserMatch{Type: matchType, Value: matchValue})
+}
+
+// AddTemporaryRuleToBrowser adds a rule which expires once the given time-to-live has passed
+func (s *Settings) AddTemporaryRuleToBrowser(b *Browser, matchType, matchValue string, ttl time.Duration) {
+	expiresAt := s.Environment.now().Add(ttl)
+
+	s.AddMatchToBrowser(b, BrowserMatch{Type: matchType, Value: matchValue, ExpiresAt: &expiresAt})
+}
+
+// AddMatchToBrowser adds the given rule, with all of its conditions, to the browser
+func (s *Settings) AddMatchToBrowser(b *Browser, match BrowserMatch) {
 	for i := range s.Browsers {
 		if s.Browsers[i].Command == b.Command {
-			s.Browsers[i].Matches = append(
-				s.Browsers[i].Matches,
-				BrowserMatch{
-					Type:  matchType,
-					Value: matchValue,
-				},
-			)
+			s.Browsers[i].Matches = append(s.Browsers[i].Matches, match)
 		}
 	}
+
+	s.matcher = nil
+}
+
+// RemoveExpiredRules removes the temporary rules which have expired by the given time and returns the number of rules
+// removed
+func (s *Settings) RemoveExpiredRules(now time.Time) int {
+	removed := 0
+
+	for i := range s.Browsers {
+		s.Browsers[i].Matches = slices.DeleteFunc(s.Browsers[i].Matches, func(match BrowserMatch) bool {
+			if match.IsExpired(now) {
+				removed++
+				return true
+			}
+			return false
+		})
+	}
+
+	if removed > 0 {
+		s.matcher = nil
+	}
+
+	return removed
 }
 
 type SettingsService interface {
@@ -222,12 +535,29 @@ type SettingsService interface {
 	// ReadSettings reads the config-file and returns the settings
 	ReadSettings() (*Settings, error)
 
-	// WriteSettings writes the settings to the config-file
-	WriteSettings(settings *Settings) error
+	// WriteSettings writes the settings to the config-file, recording the given change in the history
+	WriteSettings(settings *Settings, change SettingsChange) error
+
+	// UpdateSettings reads the settings, applies the update to them and writes them back as a single operation, so
+	// that concurrent updates don't overwrite each other. The given change is recorded in the history.
+	UpdateSettings(change SettingsChange, update func(settings *Settings) error) error
+
+	// GetSettingsHistory returns the changes recorded in the history of the config-file, the latest first
+	GetSettingsHistory() ([]SettingsHistoryEntry, error)
+
+	// UndoSettingsChanges restores the config-file as it was before the given number of the latest changes, removing
+	// them from the history, and returns the changes undone
+	UndoSettingsChanges(count int) ([]SettingsHistoryEntry, error)
+
+	// RefreshSubscriptions fetches the subscriptions to the URLs which are due for a refresh, or all of them if forced
+	RefreshSubscriptions(force bool) error
 
 	// ScanBrowsers scans (or re-scans) the system for available browsers and creates/updates the config-file
 	ScanBrowsers() error
 
+	// GetConfigFilePath returns the path to the config-file
+	GetConfigFilePath() string
+
 	// GetLogFilePath returns the path to the config-file
 	GetLogFilePath() string
 
@@ -241,6 +571,7 @@ type SettingsService interface {
 
 func GetDefaultSettings() *Settings {
 	return &Settings{
+		Version:  SettingsVersion,
 		LogLevel: "info",
 		Browsers: nil,
 		Ui:       UiSettings{},
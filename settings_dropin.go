@@ -0,0 +1,211 @@
+package linkquisition
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrDropInValue = errors.New("the value is set by a drop-in")
+
+// inheritedValues holds the single values taken from the drop-ins, so that they aren't written to the user's own
+// config-file unless changed
+type inheritedValues struct {
+	logLevel               inheritedValue
+	resolution             inheritedValue
+	activeMode             inheritedValue
+	hideKeyboardGuideLabel inheritedValue
+}
+
+// inheritedValue is a single value along with the drop-in it's taken from; the zero value for a value not inherited
+type inheritedValue struct {
+	value  string
+	origin string
+}
+
+// MergeDropIn merges the settings of a drop-in file into the settings. The settings merged so far take precedence:
+// a single value is only taken from the drop-in if it isn't set yet, and the browsers, rules, modes and plugins of the
+// drop-in come after the existing ones. A browser with an existing command gets the rules of the drop-in appended to
+// its own, and so does a mode with an existing name, whereas a plugin or a subscription with an existing path (or
+// source) is left out.
+//
+// Everything taken from the drop-in is marked with the given origin, so that it can be left out when writing the
+// settings, see WithoutDropIns.
+func (s *Settings) MergeDropIn(dropIn *Settings, origin string) {
+	if s.LogLevel == "" && dropIn.LogLevel != "" {
+		s.LogLevel, s.inherited.logLevel = dropIn.LogLevel, inheritedValue{dropIn.LogLevel, origin}
+	}
+	if s.Resolution == "" && dropIn.Resolution != "" {
+		s.Resolution, s.inherited.resolution = dropIn.Resolution, inheritedValue{dropIn.Resolution, origin}
+	}
+	if s.ActiveMode == "" && dropIn.ActiveMode != "" {
+		s.ActiveMode, s.inherited.activeMode = dropIn.ActiveMode, inheritedValue{dropIn.ActiveMode, origin}
+	}
+	if !s.Ui.HideKeyboardGuideLabel && dropIn.Ui.HideKeyboardGuideLabel {
+		s.Ui.HideKeyboardGuideLabel, s.inherited.hideKeyboardGuideLabel = true, inheritedValue{"true", origin}
+	}
+
+	for i := range dropIn.Browsers {
+		browser := dropIn.Browsers[i]
+		matches := matchesWithOrigin(browser.Matches, origin)
+
+		if j := slices.IndexFunc(s.Browsers, func(b BrowserSettings) bool { return b.Command == browser.Command }); j >= 0 {
+			s.Browsers[j].Matches = append(s.Browsers[j].Matches, matches...)
+			continue
+		}
+
+		browser.Origin = origin
+		browser.Matches = matches
+		s.Browsers = append(s.Browsers, browser)
+	}
+
+	s.Rules = append(s.Rules, rulesWithOrigin(dropIn.Rules, origin)...)
+
+	for i := range dropIn.Modes {
+		mode := dropIn.Modes[i]
+		rules := rulesWithOrigin(mode.Rules, origin)
+
+		if j := slices.IndexFunc(s.Modes, func(m Mode) bool { return m.Name == mode.Name }); j >= 0 {
+			s.Modes[j].Rules = append(s.Modes[j].Rules, rules...)
+			continue
+		}
+
+		mode.Origin = origin
+		mode.Rules = rules
+		s.Modes = append(s.Modes, mode)
+	}
+
+	for i := range dropIn.Plugins {
+		plugin := dropIn.Plugins[i]
+
+		if slices.ContainsFunc(s.Plugins, func(p PluginSettings) bool { return p.Path == plugin.Path }) {
+			continue
+		}
+
+		plugin.Origin = origin
+		s.Plugins = append(s.Plugins, plugin)
+	}
+
+	for i := range dropIn.Subscriptions {
+		subscription := dropIn.Subscriptions[i]
+
+		if slices.ContainsFunc(s.Subscriptions, func(sub Subscription) bool { return sub.Source == subscription.Source }) {
+			continue
+		}
+
+		subscription.Origin = origin
+		s.Subscriptions = append(s.Subscriptions, subscription)
+	}
+
+	s.matcher = nil
+}
+
+// WithoutDropIns returns a copy of the settings with everything merged from the drop-ins and the policies left out, i.e.
+// the user's own settings along with any changes made to them. A browser coming from a drop-in is kept only for the
+// rules the user has added to it, and a plugin replaced by a policy is restored as the user had it.
+func (s *Settings) WithoutDropIns() *Settings {
+	own := *s
+	own.matcher = nil
+	own.matcherErr = nil
+	own.inherited = inheritedValues{}
+	own.overriddenPlugins = nil
+
+	if s.inherited.logLevel.origin != "" && own.LogLevel == s.inherited.logLevel.value {
+		own.LogLevel = ""
+	}
+	if s.inherited.resolution.origin != "" && own.Resolution == s.inherited.resolution.value {
+		own.Resolution = ""
+	}
+	if s.inherited.activeMode.origin != "" && own.ActiveMode == s.inherited.activeMode.value {
+		own.ActiveMode = ""
+	}
+	if s.inherited.hideKeyboardGuideLabel.origin != "" && own.Ui.HideKeyboardGuideLabel {
+		own.Ui.HideKeyboardGuideLabel = false
+	}
+
+	own.Browsers = nil
+	if s.Browsers != nil {
+		own.Browsers = make([]BrowserSettings, 0, len(s.Browsers))
+	}
+	for i := range s.Browsers {
+		browser := s.Browsers[i]
+		browser.Matches = slices.DeleteFunc(slices.Clone(browser.Matches), func(m BrowserMatch) bool { return m.Origin != "" })
+
+		if browser.Origin == "" || len(browser.Matches) > 0 {
+			browser.Origin = ""
+			own.Browsers = append(own.Browsers, browser)
+		}
+	}
+
+	own.Rules = ownRules(s.Rules)
+
+	own.Modes = nil
+	for i := range s.Modes {
+		mode := s.Modes[i]
+		mode.Rules = ownRules(mode.Rules)
+
+		if mode.Origin == "" || len(mode.Rules) > 0 {
+			mode.Origin = ""
+			own.Modes = append(own.Modes, mode)
+		}
+	}
+
+	own.Plugins = nil
+	for i := range s.Plugins {
+		if s.Plugins[i].Origin == "" {
+			own.Plugins = append(own.Plugins, s.Plugins[i])
+		} else if plugin, overridden := s.overriddenPlugins[s.Plugins[i].Path]; overridden {
+			own.Plugins = append(own.Plugins, plugin)
+		}
+	}
+
+	own.Subscriptions = slices.DeleteFunc(slices.Clone(s.Subscriptions), func(sub Subscription) bool { return sub.Origin != "" })
+
+	return &own
+}
+
+// CheckDropInValues returns ErrDropInValue, naming the drop-in, for a single value taken from a drop-in that has since
+// been unset. The empty value isn't written to the config-file, so the drop-in would set the value again on the next
+// read: the value has to be changed in the drop-in instead.
+func (s *Settings) CheckDropInValues() error {
+	for _, value := range []struct {
+		name      string
+		inherited inheritedValue
+		isUnset   bool
+	}{
+		{name: "logLevel", inherited: s.inherited.logLevel, isUnset: s.LogLevel == ""},
+		{name: "resolution", inherited: s.inherited.resolution, isUnset: s.Resolution == ""},
+		{name: "activeMode", inherited: s.inherited.activeMode, isUnset: s.ActiveMode == ""},
+		{name: "ui.hideKeyboardGuideLabel", inherited: s.inherited.hideKeyboardGuideLabel, isUnset: !s.Ui.HideKeyboardGuideLabel},
+	} {
+		if value.inherited.origin != "" && value.isUnset {
+			return fmt.Errorf(
+				"%w: `%s` can't be unset here, change it in the drop-in `%s` instead", ErrDropInValue, value.name, value.inherited.origin,
+			)
+		}
+	}
+
+	return nil
+}
+
+func matchesWithOrigin(matches []BrowserMatch, origin string) []BrowserMatch {
+	matches = slices.Clone(matches)
+	for i := range matches {
+		matches[i].Origin = origin
+	}
+
+	return matches
+}
+
+func rulesWithOrigin(rules []Rule, origin string) []Rule {
+	rules = slices.Clone(rules)
+	for i := range rules {
+		rules[i].Origin = origin
+	}
+
+	return rules
+}
+
+func ownRules(rules []Rule) []Rule {
+	return slices.DeleteFunc(slices.Clone(rules), func(r Rule) bool { return r.Origin != "" })
+}
@@ -0,0 +1,187 @@
+package linkquisition_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestSettings_MergeDropIn(t *testing.T) {
+	settings := &Settings{
+		LogLevel: "debug",
+		Browsers: []BrowserSettings{
+			{Name: "My Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "www.example.com"}}},
+		},
+		Plugins: []PluginSettings{{Path: "unwrap.so", Settings: map[string]any{"requireBrowserMatchToUnwrap": true}}},
+	}
+
+	settings.MergeDropIn(
+		&Settings{
+			LogLevel:   "warn",
+			Resolution: ResolutionMostSpecific,
+			Browsers: []BrowserSettings{
+				{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "corp.example"}}},
+				{Name: "Chromium", Command: "chromium %U", Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "meet.corp.example"}}},
+			},
+			Rules:   []Rule{{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeDomain, Value: "tracker.example"}, Action: RuleActionBlock}},
+			Modes:   []Mode{{Name: "work", Rules: []Rule{{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "a.example"}, Action: RuleActionAsk}}}},
+			Plugins: []PluginSettings{{Path: "unwrap.so"}, {Path: "terminus.so"}},
+		},
+		"10-team.json",
+	)
+	settings.MergeDropIn(
+		&Settings{
+			Resolution: ResolutionOrder,
+			Modes:      []Mode{{Name: "work", Rules: []Rule{{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "b.example"}, Action: RuleActionAsk}}}},
+		},
+		"20-other.json",
+	)
+
+	// the user's own values take precedence, and an earlier drop-in over a later one
+	assert.Equal(t, "debug", settings.LogLevel)
+	assert.Equal(t, ResolutionMostSpecific, settings.Resolution)
+
+	require.Len(t, settings.Browsers, 2)
+	assert.Equal(t, "My Firefox", settings.Browsers[0].Name)
+	assert.Equal(
+		t,
+		[]BrowserMatch{
+			{Type: BrowserMatchTypeSite, Value: "www.example.com"},
+			{Type: BrowserMatchTypeDomain, Value: "corp.example", Origin: "10-team.json"},
+		},
+		settings.Browsers[0].Matches,
+	)
+	assert.Equal(t, "10-team.json", settings.Browsers[1].Origin)
+
+	require.Len(t, settings.Modes, 1)
+	require.Len(t, settings.Modes[0].Rules, 2)
+	assert.Equal(t, "20-other.json", settings.Modes[0].Rules[1].Origin)
+
+	require.Len(t, settings.Plugins, 2)
+	assert.Equal(t, map[string]any{"requireBrowserMatchToUnwrap": true}, settings.Plugins[0].Settings)
+	assert.Equal(t, "terminus.so", settings.Plugins[1].Path)
+
+	browser, err := settings.GetMatchingBrowser("https://wiki.corp.example/")
+	require.NoError(t, err)
+	assert.Equal(t, "My Firefox", browser.Name)
+
+	_, err = settings.GetMatchingBrowser("https://tracker.example/")
+	assert.ErrorIs(t, err, ErrNoBrowserAction)
+}
+
+func TestSettings_WithoutDropIns(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "www.example.com"}}},
+		},
+		Rules: []Rule{{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "ads.example"}, Action: RuleActionBlock}},
+	}
+
+	settings.MergeDropIn(
+		&Settings{
+			LogLevel: "warn",
+			Ui:       UiSettings{HideKeyboardGuideLabel: true},
+			Browsers: []BrowserSettings{
+				{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "corp.example"}}},
+				{Name: "Chromium", Command: "chromium %U", Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "meet.corp.example"}}},
+				{Name: "Edge", Command: "edge %U"},
+			},
+			Rules:   []Rule{{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeDomain, Value: "tracker.example"}, Action: RuleActionBlock}},
+			Modes:   []Mode{{Name: "work"}},
+			Plugins: []PluginSettings{{Path: "terminus.so"}},
+		},
+		"10-team.json",
+	)
+
+	t.Run(
+		"nothing merged from the drop-ins is left", func(t *testing.T) {
+			assert.Equal(
+				t,
+				[]BrowserSettings{
+					{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "www.example.com"}}},
+				},
+				settings.WithoutDropIns().Browsers,
+			)
+			assert.Equal(
+				t,
+				[]Rule{{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "ads.example"}, Action: RuleActionBlock}},
+				settings.WithoutDropIns().Rules,
+			)
+			assert.Empty(t, settings.WithoutDropIns().Modes)
+			assert.Empty(t, settings.WithoutDropIns().Plugins)
+			assert.Empty(t, settings.WithoutDropIns().LogLevel)
+			assert.False(t, settings.WithoutDropIns().Ui.HideKeyboardGuideLabel)
+		},
+	)
+
+	t.Run(
+		"the changes made by the user are kept", func(t *testing.T) {
+			settings.LogLevel = "error"
+			settings.AddRuleToBrowser(&Browser{Name: "Chromium", Command: "chromium %U"}, BrowserMatchTypeSite, "docs.example")
+
+			without := settings.WithoutDropIns()
+			assert.Equal(t, "error", without.LogLevel)
+			require.Len(t, without.Browsers, 2)
+			assert.Equal(t, "Chromium", without.Browsers[1].Name)
+			assert.Empty(t, without.Browsers[1].Origin)
+			assert.Equal(t, []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "docs.example"}}, without.Browsers[1].Matches)
+		},
+	)
+}
+
+func TestSettings_CheckDropInValues(t *testing.T) {
+	newSettings := func() *Settings {
+		settings := &Settings{Modes: []Mode{{Name: "work"}, {Name: "client"}}}
+		settings.MergeDropIn(
+			&Settings{LogLevel: "warn", ActiveMode: "work", Ui: UiSettings{HideKeyboardGuideLabel: true}},
+			"10-team.json",
+		)
+		return settings
+	}
+
+	t.Run("the values merged from the drop-in as they are", func(t *testing.T) {
+		settings := newSettings()
+		require.NoError(t, settings.CheckDropInValues())
+		assert.Empty(t, settings.WithoutDropIns().ActiveMode)
+	})
+
+	t.Run("a mode of the drop-in can't be deactivated", func(t *testing.T) {
+		settings := newSettings()
+		err := settings.SetActiveMode("")
+		require.ErrorIs(t, err, ErrDropInValue)
+		assert.Contains(t, err.Error(), "10-team.json")
+		assert.Equal(t, "work", settings.ActiveMode)
+	})
+
+	t.Run("another mode is the user's own", func(t *testing.T) {
+		settings := newSettings()
+		require.NoError(t, settings.SetActiveMode("client"))
+		assert.Equal(t, "client", settings.WithoutDropIns().ActiveMode)
+
+		require.NoError(t, settings.SetActiveMode(""))
+		assert.Empty(t, settings.WithoutDropIns().ActiveMode)
+	})
+
+	t.Run("the mode of the drop-in chosen by the user is the user's own", func(t *testing.T) {
+		settings := newSettings()
+		require.NoError(t, settings.SetActiveMode("work"))
+		assert.Equal(t, "work", settings.WithoutDropIns().ActiveMode)
+	})
+
+	t.Run("a value of the drop-in unset otherwise is refused", func(t *testing.T) {
+		for _, unset := range []func(settings *Settings){
+			func(settings *Settings) { settings.LogLevel = "" },
+			func(settings *Settings) { settings.Ui.HideKeyboardGuideLabel = false },
+		} {
+			settings := newSettings()
+			unset(settings)
+
+			err := settings.CheckDropInValues()
+			require.ErrorIs(t, err, ErrDropInValue)
+			assert.Contains(t, err.Error(), "10-team.json")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package linkquisition
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+// The kinds of changes recorded in the history of the config-file
+const (
+	// SettingsChangeRemember is a choice remembered in the picker
+	SettingsChangeRemember = "remember"
+
+	// SettingsChangeScan is a (re-)scan of the browsers
+	SettingsChangeScan = "scan"
+
+	// SettingsChangeConfigurator is an edit made in the settings window
+	SettingsChangeConfigurator = "configurator"
+
+	// SettingsChangeCommand is a change made with a command, such as `mode` or `rules stats --prune`
+	SettingsChangeCommand = "command"
+
+	// SettingsChangeExpire is the removal of the expired temporary rules
+	SettingsChangeExpire = "expire"
+)
+
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// SettingsChange describes a change made to the config-file, for the history
+type SettingsChange struct {
+	// Kind is one of the SettingsChange* -constants
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+
+	// Browser (the command) and Rule are the rule added by a choice remembered in the picker, so that just the rule can
+	// be removed later on, regardless of the changes made since
+	Browser string        `json:"browser,omitempty"`
+	Rule    *BrowserMatch `json:"rule,omitempty"`
+}
+
+// SettingsHistoryEntry is a change in the history of the config-file, along with the config-file as it was before the
+// change
+type SettingsHistoryEntry struct {
+	SettingsChange
+
+	Time time.Time `json:"time"`
+
+	// Previous is the content of the config-file before the change; empty if there was no config-file
+	Previous string `json:"previous"`
+}
+
+// FindUndoableRemember returns the latest choice remembered in the picker whose rule is still in the settings, or nil
+// if there's none
+func FindUndoableRemember(history []SettingsHistoryEntry, settings *Settings) *SettingsHistoryEntry {
+	for i := range history {
+		entry := &history[i]
+		if entry.Kind != SettingsChangeRemember || entry.Rule == nil {
+			continue
+		}
+		if _, j := settings.findOwnMatch(entry.Browser, entry.Rule); j >= 0 {
+			return entry
+		}
+	}
+
+	return nil
+}
+
+// RemoveMatchFromBrowser removes the latest of the user's own rules of the browser (by its command) equal to the given
+// one, returning false if there's none
+func (s *Settings) RemoveMatchFromBrowser(command string, match *BrowserMatch) bool {
+	i, j := s.findOwnMatch(command, match)
+	if j < 0 {
+		return false
+	}
+
+	s.Browsers[i].Matches = slices.Delete(s.Browsers[i].Matches, j, j+1)
+	s.matcher = nil
+
+	return true
+}
+
+// findOwnMatch returns the indexes of the browser and of the latest of the user's own rules of it equal to the given
+// one, or -1 for the rule if there's none
+func (s *Settings) findOwnMatch(command string, match *BrowserMatch) (browser, rule int) {
+	for i := range s.Browsers {
+		if s.Browsers[i].Command != command {
+			continue
+		}
+
+		for j := len(s.Browsers[i].Matches) - 1; j >= 0; j-- {
+			if m := &s.Browsers[i].Matches[j]; m.Origin == "" && isSameMatch(m, match) {
+				return i, j
+			}
+		}
+	}
+
+	return -1, -1
+}
+
+// isSameMatch returns true if the rules are the same as written in the config-file, which is all the history has of
+// a rule
+func isSameMatch(a, b *BrowserMatch) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
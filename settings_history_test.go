@@ -0,0 +1,65 @@
+package linkquisition_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestFindUndoableRemember(t *testing.T) {
+	firefox := &Browser{Name: "Firefox", Command: "firefox %u"}
+	remembered := func(value string) SettingsHistoryEntry {
+		return SettingsHistoryEntry{SettingsChange: SettingsChange{
+			Kind:    SettingsChangeRemember,
+			Browser: firefox.Command,
+			Rule:    &BrowserMatch{Type: BrowserMatchTypeSite, Value: value},
+		}}
+	}
+
+	settings := &Settings{Browsers: []BrowserSettings{{Name: firefox.Name, Command: firefox.Command}}}
+	settings.AddRuleToBrowser(firefox, BrowserMatchTypeSite, "www.example.com")
+	settings.AddRuleToBrowser(firefox, BrowserMatchTypeSite, "www.example.org")
+	settings.MergeDropIn(
+		&Settings{Browsers: []BrowserSettings{{Command: firefox.Command, Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "corp.example"}}}}},
+		"/home/user/.config/linkquisition/config.d/10-team.json",
+	)
+
+	// the latest first, as returned by the history
+	history := []SettingsHistoryEntry{
+		{SettingsChange: SettingsChange{Kind: SettingsChangeExpire}},
+		remembered("corp.example"),
+		remembered("removed.example.com"),
+		{SettingsChange: SettingsChange{Kind: SettingsChangeCommand}},
+		remembered("www.example.org"),
+		remembered("www.example.com"),
+	}
+
+	t.Run("the later changes of other kinds and the rules no longer there are skipped", func(t *testing.T) {
+		latest := FindUndoableRemember(history, settings)
+		require.NotNil(t, latest)
+		assert.Equal(t, "www.example.org", latest.Rule.Value)
+	})
+
+	t.Run("only the rule of the choice is removed", func(t *testing.T) {
+		assert.True(t, settings.RemoveMatchFromBrowser(firefox.Command, history[4].Rule))
+		assert.False(t, settings.RemoveMatchFromBrowser(firefox.Command, history[4].Rule))
+
+		var values []string
+		for _, match := range settings.Browsers[0].Matches {
+			values = append(values, match.Value)
+		}
+		assert.Equal(t, []string{"www.example.com", "corp.example"}, values)
+
+		latest := FindUndoableRemember(history, settings)
+		require.NotNil(t, latest)
+		assert.Equal(t, "www.example.com", latest.Rule.Value)
+	})
+
+	t.Run("nothing to undo", func(t *testing.T) {
+		require.True(t, settings.RemoveMatchFromBrowser(firefox.Command, history[5].Rule))
+		assert.Nil(t, FindUndoableRemember(history, settings))
+	})
+}
@@ -0,0 +1,84 @@
+package linkquisition
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// SettingsVersion is the version of the config-file format written by this version of Linkquisition. Each version has
+// a migration in settingsMigrations upgrading the config-files of the previous version.
+const SettingsVersion = 1
+
+var ErrSettingsTooNew = errors.New("the config-file is of a newer version than supported")
+var ErrInvalidSettingsVersion = errors.New("invalid version")
+
+// settingsMigration upgrades a config-file by a single version. It works on the generic JSON-document rather than on
+// Settings so that it can deal with fields that no longer exist there.
+type settingsMigration struct {
+	description string
+	migrate     func(doc map[string]any) error
+}
+
+// settingsMigrations[i] upgrades a config-file from version i to version i+1
+var settingsMigrations = []settingsMigration{
+	{
+		// nothing but the version itself changes: the config-files before it were only ever extended with new
+		// optional fields
+		description: "add the version to the unversioned config-files",
+		migrate:     func(map[string]any) error { return nil },
+	},
+}
+
+// MigrateSettings upgrades the given config-file to SettingsVersion one version at a time and returns the upgraded
+// config-file along with the version it was upgraded from. A config-file already at the current version is returned
+// as is, whereas one of a newer version results in ErrSettingsTooNew.
+func MigrateSettings(data []byte) ([]byte, int, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	version, err := getSettingsVersion(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version == SettingsVersion {
+		return data, version, nil
+	}
+
+	if version > SettingsVersion {
+		return nil, version, fmt.Errorf("%w: version %d, supported up to %d", ErrSettingsTooNew, version, SettingsVersion)
+	}
+
+	for v := version; v < SettingsVersion; v++ {
+		if err := settingsMigrations[v].migrate(doc); err != nil {
+			return nil, version, fmt.Errorf("migrating to version %d (%s): %w", v+1, settingsMigrations[v].description, err)
+		}
+		doc["version"] = v + 1
+	}
+
+	migrated, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, version, err
+	}
+
+	return migrated, version, nil
+}
+
+// getSettingsVersion returns the version of the config-file; the config-files without one are of version 0
+func getSettingsVersion(doc map[string]any) (int, error) {
+	value, found := doc["version"]
+	if !found {
+		return 0, nil
+	}
+
+	version, ok := value.(float64)
+	if !ok || version < 0 || version != math.Trunc(version) {
+		return 0, fmt.Errorf("%w `%v`: expected a non-negative integer", ErrInvalidSettingsVersion, value)
+	}
+
+	return int(version), nil
+}
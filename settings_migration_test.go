@@ -0,0 +1,105 @@
+package linkquisition_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestMigrateSettings(t *testing.T) {
+	for _, tt := range [...]struct {
+		name                string
+		config              string
+		expectedFromVersion int
+		expectedErr         error
+		expectUnchanged     bool
+	}{
+		{
+			name:                "unversioned config-file is migrated",
+			config:              `{"browsers": [{"name": "Firefox", "command": "firefox %u"}]}`,
+			expectedFromVersion: 0,
+		},
+		{
+			name:                "config-file of the current version is returned as is",
+			config:              `{"version": 1, "browsers": []}`,
+			expectedFromVersion: SettingsVersion,
+			expectUnchanged:     true,
+		},
+		{
+			name:                "config-file of a newer version is refused",
+			config:              `{"version": 99, "browsers": []}`,
+			expectedFromVersion: 99,
+			expectedErr:         ErrSettingsTooNew,
+		},
+		{
+			name:        "version which is not an integer is refused",
+			config:      `{"version": "1", "browsers": []}`,
+			expectedErr: ErrInvalidSettingsVersion,
+		},
+	} {
+		t.Run(
+			tt.name, func(t *testing.T) {
+				migrated, fromVersion, err := MigrateSettings([]byte(tt.config))
+				assert.Equal(t, tt.expectedFromVersion, fromVersion)
+
+				if tt.expectedErr != nil {
+					assert.ErrorIs(t, err, tt.expectedErr)
+					return
+				}
+
+				require.NoError(t, err)
+				if tt.expectUnchanged {
+					assert.Equal(t, tt.config, string(migrated))
+				}
+
+				var settings Settings
+				require.NoError(t, json.Unmarshal(migrated, &settings))
+				assert.Equal(t, SettingsVersion, settings.Version)
+			},
+		)
+	}
+}
+
+// TestMigrateSettings_Corpus migrates the config-files of every historical version in testdata/settings. Each of them
+// has to end up at the current version with no fields left that Settings doesn't know of.
+func TestMigrateSettings_Corpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "settings", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		t.Run(
+			filepath.Base(file), func(t *testing.T) {
+				data, err := os.ReadFile(file)
+				require.NoError(t, err)
+
+				migrated, _, err := MigrateSettings(data)
+				require.NoError(t, err)
+
+				decoder := json.NewDecoder(bytes.NewReader(migrated))
+				decoder.DisallowUnknownFields()
+
+				var settings Settings
+				require.NoError(t, decoder.Decode(&settings))
+				assert.Equal(t, SettingsVersion, settings.Version)
+				assert.NotEmpty(t, settings.Browsers)
+
+				_, matcherErr := NewMatcher(&settings)
+				assert.NoError(t, matcherErr)
+
+				// migrating is idempotent
+				again, fromVersion, err := MigrateSettings(migrated)
+				require.NoError(t, err)
+				assert.Equal(t, SettingsVersion, fromVersion)
+				assert.Equal(t, migrated, again)
+			},
+		)
+	}
+}
@@ -0,0 +1,88 @@
+package linkquisition
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// SettingsParseError is returned when a config-file (or a drop-in, or a policy) exists but can't be used: it isn't
+// valid JSON, doesn't match the format or can't be migrated to the current version
+type SettingsParseError struct {
+	Path string
+
+	// Line and Column locate the error within the file; zero if the error isn't about a specific position
+	Line   int
+	Column int
+
+	Err error
+}
+
+func (e *SettingsParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("unable to parse `%s` (line %d, column %d): %v", e.Path, e.Line, e.Column, e.Err)
+	}
+
+	return fmt.Sprintf("unable to parse `%s`: %v", e.Path, e.Err)
+}
+
+func (e *SettingsParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseSettings migrates the given config-file to the current version and parses it, returning the settings along with
+// the version the config-file was migrated from. Any error is returned as a SettingsParseError for the given path.
+func ParseSettings(data []byte, path string) (*Settings, int, error) {
+	migrated, fromVersion, err := MigrateSettings(data)
+	if err != nil {
+		return nil, fromVersion, newSettingsParseError(data, path, err)
+	}
+
+	// the positions of the errors are only meaningful in the original document, which is therefore parsed in place of a
+	// migrated one no different but for the version
+	if fromVersion != SettingsVersion && isSameButVersion(data, migrated) {
+		migrated = data
+	}
+
+	settings := &Settings{}
+	if err := json.Unmarshal(migrated, settings); err != nil {
+		if !bytes.Equal(migrated, data) {
+			data = nil
+		}
+		return nil, fromVersion, newSettingsParseError(data, path, err)
+	}
+	settings.Version = SettingsVersion
+
+	return settings, fromVersion, nil
+}
+
+// isSameButVersion returns true if the given JSON-documents only differ by their versions
+func isSameButVersion(a, b []byte) bool {
+	var docA, docB map[string]any
+	if json.Unmarshal(a, &docA) != nil || json.Unmarshal(b, &docB) != nil {
+		return false
+	}
+	delete(docA, "version")
+	delete(docB, "version")
+
+	return reflect.DeepEqual(docA, docB)
+}
+
+func newSettingsParseError(data []byte, path string, err error) *SettingsParseError {
+	parseErr := &SettingsParseError{Path: path, Err: err}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case data == nil:
+	case errors.As(err, &syntaxErr):
+		parseErr.Line, parseErr.Column = offsetToPosition(data, syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		parseErr.Line, parseErr.Column = offsetToPosition(data, typeErr.Offset)
+	}
+
+	return parseErr
+}
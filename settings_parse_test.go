@@ -0,0 +1,101 @@
+package linkquisition_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestParseSettings(t *testing.T) {
+	for _, tt := range []struct {
+		name           string
+		data           string
+		expectedErr    error
+		expectedLine   int
+		expectedColumn int
+		expectedFrom   int
+	}{
+		{
+			name:         "a current config-file",
+			data:         `{"version": 1, "browsers": [{"name": "Firefox", "command": "firefox %u"}]}`,
+			expectedFrom: 1,
+		},
+		{
+			name:         "an old config-file is migrated",
+			data:         `{"browsers": [{"name": "Firefox", "command": "firefox %u"}]}`,
+			expectedFrom: 0,
+		},
+		{
+			name:           "a truncated config-file",
+			data:           "{\n  \"version\": 1,\n  \"browsers\": [",
+			expectedLine:   3,
+			expectedColumn: 16,
+		},
+		{
+			name:           "a value of the wrong type",
+			data:           "{\n  \"version\": 1,\n  \"browsers\": [{\"name\": 42}]\n}",
+			expectedLine:   3,
+			expectedColumn: 27,
+			expectedFrom:   1,
+		},
+		{
+			name:           "a value of the wrong type in an old config-file",
+			data:           "{\n  \"browsers\": [{\"name\": 42}]\n}",
+			expectedLine:   2,
+			expectedColumn: 27,
+		},
+		{
+			name:         "a config-file of a newer version",
+			data:         `{"version": 999}`,
+			expectedErr:  ErrSettingsTooNew,
+			expectedFrom: 999,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			settings, fromVersion, err := ParseSettings([]byte(tt.data), "/home/user/.config/linkquisition/config.json")
+			assert.Equal(t, tt.expectedFrom, fromVersion)
+
+			if tt.expectedErr == nil && tt.expectedLine == 0 {
+				require.NoError(t, err)
+				assert.Equal(t, SettingsVersion, settings.Version)
+				assert.Equal(t, "Firefox", settings.Browsers[0].Name)
+				return
+			}
+
+			var parseErr *SettingsParseError
+			require.ErrorAs(t, err, &parseErr)
+			assert.Equal(t, "/home/user/.config/linkquisition/config.json", parseErr.Path)
+			assert.Equal(t, tt.expectedLine, parseErr.Line)
+			assert.Equal(t, tt.expectedColumn, parseErr.Column)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestSettings_Clone(t *testing.T) {
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "www.example.com"}}},
+		},
+		Plugins: []PluginSettings{{Path: "unwrap.so", Settings: map[string]any{"requireBrowserMatchToUnwrap": true}}},
+		Modes:   []Mode{{Name: "work"}},
+	}
+	original, err := json.Marshal(settings)
+	require.NoError(t, err)
+
+	clone := settings.Clone()
+	clone.AddRuleToBrowser(&Browser{Name: "Firefox", Command: "firefox %u"}, BrowserMatchTypeDomain, "example.org")
+	clone.Browsers[0].Matches[0].Value = "www.example.org"
+	clone.Plugins[0].Settings["requireBrowserMatchToUnwrap"] = false
+	clone.Modes[0].Rules = append(clone.Modes[0].Rules, Rule{Action: RuleActionBlock})
+
+	unchanged, err := json.Marshal(settings)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(original), string(unchanged))
+}
@@ -0,0 +1,99 @@
+package linkquisition
+
+import (
+	"slices"
+)
+
+// ApplyPolicy applies a system-wide policy over the settings. Unlike a drop-in, the policy takes precedence over the
+// user's settings: its rules are locked, i.e. they win over every rule that isn't, and its plugins replace the ones
+// with the same path, settings and all. A browser with an existing command gets the rules of the policy appended to
+// its own. Only the browsers, the top-level rules and the plugins are taken from the policy.
+//
+// When several policies are applied, the one applied first takes precedence over the rest. Everything taken from the
+// policy is marked with the given origin, so that it's left out when writing the settings, see WithoutDropIns.
+func (s *Settings) ApplyPolicy(policy *Settings, origin string) {
+	for i := range policy.Browsers {
+		browser := policy.Browsers[i]
+		matches := lockedMatches(browser.Matches, origin)
+
+		if j := slices.IndexFunc(s.Browsers, func(b BrowserSettings) bool { return b.Command == browser.Command }); j >= 0 {
+			s.Browsers[j].Matches = append(s.Browsers[j].Matches, matches...)
+			continue
+		}
+
+		browser.Origin = origin
+		browser.Matches = matches
+		s.Browsers = append(s.Browsers, browser)
+	}
+
+	rules := rulesWithOrigin(policy.Rules, origin)
+	for i := range rules {
+		rules[i].Locked = true
+	}
+	s.Rules = append(s.Rules, rules...)
+
+	for i := range policy.Plugins {
+		plugin := policy.Plugins[i]
+		plugin.Origin = origin
+		plugin.Locked = true
+
+		j := slices.IndexFunc(s.Plugins, func(p PluginSettings) bool { return p.Path == plugin.Path })
+		switch {
+		case j < 0:
+			s.Plugins = append(s.Plugins, plugin)
+		case s.Plugins[j].Locked:
+			// an earlier policy has the final say
+		default:
+			if s.Plugins[j].Origin == "" {
+				if s.overriddenPlugins == nil {
+					s.overriddenPlugins = map[string]PluginSettings{}
+				}
+				s.overriddenPlugins[plugin.Path] = s.Plugins[j]
+			}
+			s.Plugins[j] = plugin
+		}
+	}
+
+	s.matcher = nil
+}
+
+// IsLocked returns true if the URL is matched by a rule locked by a policy, in which case remembering a browser for it
+// would have no effect
+func (s *Settings) IsLocked(u string) bool {
+	m, _ := s.GetMatcher()
+
+	result, err := m.Match(u)
+
+	return err == nil && result.Rule.Locked
+}
+
+// GetLockedRules returns the top-level rules locked by a policy, followed by the locked browser-rules as rules opening
+// the URLs with their browser
+func (s *Settings) GetLockedRules() []Rule {
+	var locked []Rule
+
+	for i := range s.Rules {
+		if s.Rules[i].Locked {
+			locked = append(locked, s.Rules[i])
+		}
+	}
+
+	for i := range s.Browsers {
+		for _, match := range s.Browsers[i].Matches {
+			if match.Locked {
+				locked = append(locked, Rule{BrowserMatch: match, Action: RuleActionOpen, Browser: s.Browsers[i].Name})
+			}
+		}
+	}
+
+	return locked
+}
+
+func lockedMatches(matches []BrowserMatch, origin string) []BrowserMatch {
+	matches = matchesWithOrigin(matches, origin)
+	for i := range matches {
+		matches[i].Locked = true
+	}
+
+	return matches
+}
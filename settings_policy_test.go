@@ -0,0 +1,117 @@
+package linkquisition_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestSettings_ApplyPolicy(t *testing.T) {
+	settings := &Settings{
+		Resolution: ResolutionMostSpecific,
+		Browsers: []BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "sso.corp.example", Priority: 100}}},
+		},
+		Plugins: []PluginSettings{{Path: "unwrap.so", IsDisabled: true}},
+	}
+
+	settings.ApplyPolicy(
+		&Settings{
+			Browsers: []BrowserSettings{
+				{Name: "Managed Chrome", Command: "google-chrome %U", Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "corp.example"}}},
+			},
+			Rules:   []Rule{{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "hr.example"}, Action: RuleActionOpen, Browser: "Managed Chrome"}},
+			Plugins: []PluginSettings{{Path: "unwrap.so", Settings: map[string]any{"requireBrowserMatchToUnwrap": false}}},
+		},
+		"/etc/xdg/linkquisition/policy.json",
+	)
+	settings.ApplyPolicy(
+		&Settings{Plugins: []PluginSettings{{Path: "unwrap.so", IsDisabled: true}, {Path: "terminus.so"}}},
+		"/usr/local/etc/xdg/linkquisition/policy.json",
+	)
+
+	for _, tt := range []struct {
+		name            string
+		url             string
+		expectedBrowser string
+		expectedLocked  bool
+	}{
+		{
+			name:            "a locked rule wins over a more specific rule with a higher priority",
+			url:             "https://sso.corp.example/login",
+			expectedBrowser: "Managed Chrome",
+			expectedLocked:  true,
+		},
+		{
+			name:            "a locked top-level rule",
+			url:             "https://hr.example/",
+			expectedBrowser: "Managed Chrome",
+			expectedLocked:  true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			browser, err := settings.GetMatchingBrowser(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBrowser, browser.Name)
+			assert.Equal(t, tt.expectedLocked, settings.IsLocked(tt.url))
+		})
+	}
+
+	t.Run("a remembered choice can't override a locked rule", func(t *testing.T) {
+		settings.AddRuleToBrowser(&Browser{Name: "Firefox", Command: "firefox %u"}, BrowserMatchTypeSite, "hr.example")
+
+		browser, err := settings.GetMatchingBrowser("https://hr.example/")
+		require.NoError(t, err)
+		assert.Equal(t, "Managed Chrome", browser.Name)
+	})
+
+	t.Run("the plugins of the first policy take precedence", func(t *testing.T) {
+		require.Len(t, settings.Plugins, 2)
+		assert.False(t, settings.Plugins[0].IsDisabled)
+		assert.Equal(t, map[string]any{"requireBrowserMatchToUnwrap": false}, settings.Plugins[0].Settings)
+		assert.True(t, settings.Plugins[0].Locked)
+		assert.Equal(t, "terminus.so", settings.Plugins[1].Path)
+	})
+
+	t.Run("the locked rules are listed", func(t *testing.T) {
+		assert.Equal(
+			t,
+			[]Rule{
+				{
+					BrowserMatch: BrowserMatch{
+						Type: BrowserMatchTypeSite, Value: "hr.example", Origin: "/etc/xdg/linkquisition/policy.json", Locked: true,
+					},
+					Action:  RuleActionOpen,
+					Browser: "Managed Chrome",
+				},
+				{
+					BrowserMatch: BrowserMatch{
+						Type: BrowserMatchTypeDomain, Value: "corp.example", Origin: "/etc/xdg/linkquisition/policy.json", Locked: true,
+					},
+					Action:  RuleActionOpen,
+					Browser: "Managed Chrome",
+				},
+			},
+			settings.GetLockedRules(),
+		)
+	})
+
+	t.Run("nothing from the policy is written", func(t *testing.T) {
+		own := settings.WithoutDropIns()
+
+		assert.Empty(t, own.Rules)
+		assert.Equal(t, []PluginSettings{{Path: "unwrap.so", IsDisabled: true}}, own.Plugins)
+		require.Len(t, own.Browsers, 1)
+		assert.Equal(
+			t,
+			[]BrowserMatch{
+				{Type: BrowserMatchTypeSite, Value: "sso.corp.example", Priority: 100},
+				{Type: BrowserMatchTypeSite, Value: "hr.example"},
+			},
+			own.Browsers[0].Matches,
+		)
+	})
+}
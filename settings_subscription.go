@@ -0,0 +1,90 @@
+package linkquisition
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SubscriptionRefreshDefault is how often a subscription to a URL is fetched again unless configured otherwise
+const SubscriptionRefreshDefault = 24 * time.Hour
+
+var ErrInsecureSubscription = errors.New("a subscription has to use https")
+var ErrRelativeSubscription = errors.New("the path of a subscription has to be absolute")
+
+// Subscription points to a file of rules shared by a team, either a local path or an https URL. The file is in the
+// format of the config-file, but only its top-level rules are used; they open the URLs with a browser by its role
+// rather than by its name, so that everyone can map the role to a browser of their own, see BrowserSettings.Roles.
+type Subscription struct {
+	// Source is the path to, or the URL of, the file of rules
+	Source string `json:"source"`
+
+	// Refresh is how often the URL is fetched again, as a duration such as `1h`; SubscriptionRefreshDefault if unset
+	Refresh string `json:"refresh,omitempty"`
+
+	// IsDisabled allows temporarily leaving the rules of the subscription out
+	IsDisabled bool `json:"isDisabled,omitempty"`
+
+	// Origin is the drop-in file the subscription comes from; empty for the subscriptions of the user's own config-file
+	Origin string `json:"-"`
+}
+
+// IsRemote returns true if the subscription is fetched from a URL rather than read from a local file
+func (s *Subscription) IsRemote() bool {
+	return strings.HasPrefix(s.Source, "http://") || strings.HasPrefix(s.Source, "https://")
+}
+
+// Validate returns ErrInsecureSubscription for a plain http URL, whose rules anyone on the way could replace, and
+// ErrRelativeSubscription for a relative path, which would depend on where linkquisition happens to be started from
+func (s *Subscription) Validate() error {
+	if strings.HasPrefix(s.Source, "http://") {
+		return ErrInsecureSubscription
+	}
+	if !s.IsRemote() && !filepath.IsAbs(s.Source) {
+		return ErrRelativeSubscription
+	}
+
+	return nil
+}
+
+// GetRefreshInterval returns how often the subscription is fetched again; an invalid Refresh falls back to the default
+func (s *Subscription) GetRefreshInterval() time.Duration {
+	if interval, err := time.ParseDuration(s.Refresh); err == nil && interval > 0 {
+		return interval
+	}
+
+	return SubscriptionRefreshDefault
+}
+
+// MergeSubscription merges the rules of a subscribed file into the settings. The rules are marked with the source of the
+// subscription as their origin, which makes them read-only: they're left out when writing the settings, see
+// WithoutDropIns. A shared file can only choose where a link opens, never what happens to the link otherwise: only the
+// rules opening the URL are merged, without their rewrites and priorities, and they lose to every rule of the user's
+// own, the drop-ins' and the policies'.
+func (s *Settings) MergeSubscription(subscribed *Settings, source string) {
+	for _, rule := range rulesWithOrigin(subscribed.Rules, source) {
+		if rule.Action != RuleActionOpen {
+			continue
+		}
+
+		rule.Rewrite = nil
+		rule.Priority = 0
+		rule.Subscribed = true
+		s.Rules = append(s.Rules, rule)
+	}
+
+	s.matcher = nil
+}
+
+// GetSubscriptionRules returns the rules merged from the subscription of the given source
+func (s *Settings) GetSubscriptionRules(source string) []Rule {
+	var rules []Rule
+	for i := range s.Rules {
+		if s.Rules[i].Origin == source {
+			rules = append(rules, s.Rules[i])
+		}
+	}
+
+	return rules
+}
@@ -0,0 +1,183 @@
+package linkquisition_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/strobotti/linkquisition"
+)
+
+func TestSettings_MergeSubscription(t *testing.T) {
+	const source = "https://intranet.example.com/rules.json"
+
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{Name: "Firefox", Command: "firefox %u"},
+			{Name: "Chrome (work)", Command: "google-chrome --profile-directory=Work %U", Roles: []string{"work"}},
+		},
+		Rules:         []Rule{{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "wiki.example.com"}, Action: RuleActionOpen, Browser: "Firefox"}},
+		Subscriptions: []Subscription{{Source: source}},
+	}
+
+	settings.MergeSubscription(
+		&Settings{
+			Rules: []Rule{
+				{
+					BrowserMatch: BrowserMatch{Type: BrowserMatchTypeDomain, Value: "example.com", Rewrite: &UrlRewrite{Regex: ".*", Replace: "https://evil.example.net/"}},
+					Action:       RuleActionOpen,
+					Role:         "work",
+				},
+				{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "personal.example.org"}, Action: RuleActionOpen, Role: "personal"},
+			},
+		},
+		source,
+	)
+
+	for _, tt := range []struct {
+		name            string
+		url             string
+		expectedBrowser string
+	}{
+		{
+			name:            "the user's own rules come first",
+			url:             "https://wiki.example.com/",
+			expectedBrowser: "Firefox",
+		},
+		{
+			name:            "a subscribed rule opens the URL with the browser of the role",
+			url:             "https://jira.example.com/browse/ABC-1",
+			expectedBrowser: "Chrome (work)",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			browser, err := settings.GetMatchingBrowser(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedBrowser, browser.Name)
+		})
+	}
+
+	t.Run("a subscribed rule can't rewrite the URL", func(t *testing.T) {
+		matcher, _ := settings.GetMatcher()
+		result, err := matcher.Match("https://jira.example.com/browse/ABC-1")
+		require.NoError(t, err)
+		assert.Equal(t, "https://jira.example.com/browse/ABC-1", result.Url)
+		assert.Nil(t, settings.GetSubscriptionRules(source)[0].Rewrite)
+	})
+
+	t.Run("a rule of a role no browser has is reported and left out", func(t *testing.T) {
+		_, err := settings.GetMatcher()
+		require.ErrorIs(t, err, ErrUnknownRole)
+
+		_, err = settings.GetMatchingBrowser("https://personal.example.org/")
+		assert.Error(t, err)
+	})
+
+	t.Run("the rules of the subscription are listed", func(t *testing.T) {
+		rules := settings.GetSubscriptionRules(source)
+		require.Len(t, rules, 2)
+		assert.Equal(t, "work", rules[0].Role)
+	})
+
+	t.Run("the rules of the subscription are not written", func(t *testing.T) {
+		data, err := json.Marshal(settings.WithoutDropIns())
+		require.NoError(t, err)
+
+		var written Settings
+		require.NoError(t, json.Unmarshal(data, &written))
+		assert.Len(t, written.Rules, 1)
+		assert.Equal(t, []Subscription{{Source: source}}, written.Subscriptions)
+		assert.Equal(t, []string{"work"}, written.Browsers[1].Roles)
+	})
+}
+
+func TestSettings_MergeSubscription_RulesLoseToLocalRules(t *testing.T) {
+	const source = "https://intranet.example.com/rules.json"
+
+	for _, resolution := range []string{ResolutionOrder, ResolutionMostSpecific} {
+		t.Run(resolution, func(t *testing.T) {
+			settings := &Settings{
+				Resolution: resolution,
+				Browsers: []BrowserSettings{
+					{Name: "Chrome (work)", Command: "google-chrome %U", Roles: []string{"work"}},
+					{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "example.com"}}},
+				},
+			}
+
+			settings.MergeSubscription(
+				&Settings{
+					Rules: []Rule{
+						{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "jira.example.com", Priority: 100}, Action: RuleActionOpen, Role: "work"},
+						{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "www.example.com"}, Action: RuleActionBlock},
+						{BrowserMatch: BrowserMatch{Type: BrowserMatchTypeSite, Value: "wiki.corp.example"}, Action: RuleActionOpen, Role: "work"},
+					},
+				},
+				source,
+			)
+
+			for _, tt := range []struct {
+				url             string
+				expectedBrowser string
+			}{
+				{url: "https://jira.example.com/browse/ABC-1", expectedBrowser: "Firefox"},
+				{url: "https://www.example.com/", expectedBrowser: "Firefox"},
+				{url: "https://wiki.corp.example/", expectedBrowser: "Chrome (work)"},
+			} {
+				browser, err := settings.GetMatchingBrowser(tt.url)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBrowser, browser.Name, tt.url)
+			}
+
+			rules := settings.GetSubscriptionRules(source)
+			require.Len(t, rules, 2, "only the rules opening the URL are merged")
+			assert.Zero(t, rules[0].Priority)
+		})
+	}
+}
+
+func TestSettings_MergeDropIn_Subscriptions(t *testing.T) {
+	settings := &Settings{Subscriptions: []Subscription{{Source: "/srv/rules.json", Refresh: "1h"}}}
+
+	settings.MergeDropIn(
+		&Settings{Subscriptions: []Subscription{{Source: "/srv/rules.json"}, {Source: "https://example.com/rules.json"}}},
+		"/home/user/.config/linkquisition/config.d/10-team.json",
+	)
+
+	assert.Equal(
+		t,
+		[]Subscription{
+			{Source: "/srv/rules.json", Refresh: "1h"},
+			{Source: "https://example.com/rules.json", Origin: "/home/user/.config/linkquisition/config.d/10-team.json"},
+		},
+		settings.Subscriptions,
+	)
+	assert.Equal(t, []Subscription{{Source: "/srv/rules.json", Refresh: "1h"}}, settings.WithoutDropIns().Subscriptions)
+}
+
+func TestSubscription_GetRefreshInterval(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		refresh  string
+		expected time.Duration
+	}{
+		{name: "unset", refresh: "", expected: SubscriptionRefreshDefault},
+		{name: "a duration", refresh: "90m", expected: 90 * time.Minute},
+		{name: "invalid", refresh: "daily", expected: SubscriptionRefreshDefault},
+		{name: "negative", refresh: "-1h", expected: SubscriptionRefreshDefault},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription := Subscription{Source: "https://example.com/rules.json", Refresh: tt.refresh}
+			assert.Equal(t, tt.expected, subscription.GetRefreshInterval())
+		})
+	}
+}
+
+func TestSubscription_Validate(t *testing.T) {
+	assert.NoError(t, (&Subscription{Source: "https://example.com/rules.json"}).Validate())
+	assert.NoError(t, (&Subscription{Source: "/srv/rules.json"}).Validate())
+	assert.ErrorIs(t, (&Subscription{Source: "http://example.com/rules.json"}).Validate(), ErrInsecureSubscription)
+	assert.ErrorIs(t, (&Subscription{Source: "team/rules.json"}).Validate(), ErrRelativeSubscription)
+}
@@ -1,9 +1,12 @@
 package linkquisition_test
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	. "github.com/strobotti/linkquisition"
 )
@@ -168,6 +171,649 @@ func TestBrowserSettings_MatchesUrl(t *testing.T) {
 			url:      "https://github.com/",
 			expected: false,
 		},
+		{
+			name: "glob matches a subdomain",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.corp.example.com",
+					},
+				},
+			},
+			url:      "https://jira.corp.example.com/browse/ABC-1",
+			expected: true,
+		},
+		{
+			name: "glob matches a deeper subdomain",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.corp.example.com",
+					},
+				},
+			},
+			url:      "https://a.b.corp.example.com/",
+			expected: true,
+		},
+		{
+			name: "glob does not match the parent domain itself",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.corp.example.com",
+					},
+				},
+			},
+			url:      "https://corp.example.com/",
+			expected: false,
+		},
+		{
+			name: "glob does not match the registrable domain",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.corp.example.com",
+					},
+				},
+			},
+			url:      "https://example.com/",
+			expected: false,
+		},
+		{
+			name: "glob ignores the case of the host",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.corp.example.com",
+					},
+				},
+			},
+			url:      "https://JIRA.Corp.Example.com/",
+			expected: true,
+		},
+		{
+			name: "glob ignores the port",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.corp.example.com",
+					},
+				},
+			},
+			url:      "https://jira.corp.example.com:8443/",
+			expected: true,
+		},
+		{
+			name: "glob with a path matches the path itself",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.atlassian.net/wiki/**",
+					},
+				},
+			},
+			url:      "https://acme.atlassian.net/wiki",
+			expected: true,
+		},
+		{
+			name: "glob with a path matches anything below the path",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.atlassian.net/wiki/**",
+					},
+				},
+			},
+			url:      "https://acme.atlassian.net/wiki/spaces/ENG/pages/1",
+			expected: true,
+		},
+		{
+			name: "glob with a path does not match other paths",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.atlassian.net/wiki/**",
+					},
+				},
+			},
+			url:      "https://acme.atlassian.net/jira/software",
+			expected: false,
+		},
+		{
+			name: "glob with a path does not match a path only sharing the prefix",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "*.atlassian.net/wiki/**",
+					},
+				},
+			},
+			url:      "https://acme.atlassian.net/wikipedia",
+			expected: false,
+		},
+		{
+			name: "glob single star matches only one path segment",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "github.com/*/linkquisition",
+					},
+				},
+			},
+			url:      "https://github.com/Strobotti/linkquisition",
+			expected: true,
+		},
+		{
+			name: "glob single star does not match several path segments",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "github.com/*/linkquisition",
+					},
+				},
+			},
+			url:      "https://github.com/a/b/linkquisition",
+			expected: false,
+		},
+		{
+			name: "glob double star matches in the middle of the path",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "github.com/Strobotti/**/issues",
+					},
+				},
+			},
+			url:      "https://github.com/Strobotti/linkquisition/issues",
+			expected: true,
+		},
+		{
+			name: "glob path is case-sensitive",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeGlob,
+						Value: "github.com/Strobotti/**",
+					},
+				},
+			},
+			url:      "https://github.com/strobotti/linkquisition",
+			expected: false,
+		},
+		{
+			name: "path prefix matches the path itself",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypePathPrefix,
+						Value: "github.com/our-org",
+					},
+				},
+			},
+			url:      "https://github.com/our-org",
+			expected: true,
+		},
+		{
+			name: "path prefix matches anything below the path",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypePathPrefix,
+						Value: "github.com/our-org",
+					},
+				},
+			},
+			url:      "https://github.com/our-org/repo/pulls",
+			expected: true,
+		},
+		{
+			name: "path prefix does not match a path only sharing the prefix",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypePathPrefix,
+						Value: "github.com/our-org",
+					},
+				},
+			},
+			url:      "https://github.com/our-organization",
+			expected: false,
+		},
+		{
+			name: "path prefix ignores a trailing wildcard",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypePathPrefix,
+						Value: "github.com/our-org/*",
+					},
+				},
+			},
+			url:      "https://github.com/our-org/repo/pulls",
+			expected: true,
+		},
+		{
+			name: "path prefix with a trailing wildcard does not match a path only sharing the prefix",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypePathPrefix,
+						Value: "github.com/our-org/*",
+					},
+				},
+			},
+			url:      "https://github.com/our-organization",
+			expected: false,
+		},
+		{
+			name: "path prefix does not match another host",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypePathPrefix,
+						Value: "github.com/our-org",
+					},
+				},
+			},
+			url:      "https://gitlab.com/our-org",
+			expected: false,
+		},
+		{
+			name: "path prefix ignores the case of the host",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypePathPrefix,
+						Value: "github.com/our-org",
+					},
+				},
+			},
+			url:      "https://GitHub.com/our-org/repo",
+			expected: true,
+		},
+		{
+			name: "path prefix without host matches any host",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypePathPrefix,
+						Value: "/a/ourcompany.com",
+					},
+				},
+			},
+			url:      "https://mail.google.com/a/ourcompany.com/",
+			expected: true,
+		},
+		{
+			name: "query matches a parameter with the given value",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeQuery,
+						Value: "login.microsoftonline.com?tenant=acme",
+					},
+				},
+			},
+			url:      "https://login.microsoftonline.com/common/oauth2?client_id=x&tenant=acme",
+			expected: true,
+		},
+		{
+			name: "query does not match a parameter with another value",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeQuery,
+						Value: "login.microsoftonline.com?tenant=acme",
+					},
+				},
+			},
+			url:      "https://login.microsoftonline.com/common/oauth2?tenant=other",
+			expected: false,
+		},
+		{
+			name: "query does not match another host",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeQuery,
+						Value: "login.microsoftonline.com?tenant=acme",
+					},
+				},
+			},
+			url:      "https://login.example.com/?tenant=acme",
+			expected: false,
+		},
+		{
+			name: "all conditions match",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeDomain,
+						Value: "google.com",
+						All: []BrowserMatch{
+							{
+								Type:  BrowserMatchTypePathPrefix,
+								Value: "/a/ourcompany.com",
+							},
+						},
+					},
+				},
+			},
+			url:      "https://mail.google.com/a/ourcompany.com/inbox",
+			expected: true,
+		},
+		{
+			name: "all conditions must match",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeDomain,
+						Value: "google.com",
+						All: []BrowserMatch{
+							{
+								Type:  BrowserMatchTypePathPrefix,
+								Value: "/a/ourcompany.com",
+							},
+						},
+					},
+				},
+			},
+			url:      "https://mail.google.com/mail/u/0",
+			expected: false,
+		},
+		{
+			name: "all conditions match without a type of their own",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						All: []BrowserMatch{
+							{
+								Type:  BrowserMatchTypeSite,
+								Value: "login.microsoftonline.com",
+							},
+							{
+								Type:  BrowserMatchTypeQuery,
+								Value: "tenant=acme",
+							},
+						},
+					},
+				},
+			},
+			url:      "https://login.microsoftonline.com/?tenant=acme",
+			expected: true,
+		},
+		{
+			name: "exclusion prevents the match",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeDomain,
+						Value: "atlassian.net",
+						Not: []BrowserMatch{
+							{
+								Type:  BrowserMatchTypeSite,
+								Value: "status.atlassian.net",
+							},
+						},
+					},
+				},
+			},
+			url:      "https://status.atlassian.net/",
+			expected: false,
+		},
+		{
+			name: "exclusion does not affect other matches",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeDomain,
+						Value: "atlassian.net",
+						Not: []BrowserMatch{
+							{
+								Type:  BrowserMatchTypeSite,
+								Value: "status.atlassian.net",
+							},
+						},
+					},
+				},
+			},
+			url:      "https://acme.atlassian.net/wiki",
+			expected: true,
+		},
+		{
+			name: "nested exclusions within conditions are evaluated",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeDomain,
+						Value: "example.com",
+						All: []BrowserMatch{
+							{
+								Type:  BrowserMatchTypeGlob,
+								Value: "*.example.com",
+								Not: []BrowserMatch{
+									{
+										Type:  BrowserMatchTypeSite,
+										Value: "www.example.com",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			url:      "https://www.example.com/",
+			expected: false,
+		},
+		{
+			name: "rule without type nor conditions never matches",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Not: []BrowserMatch{
+							{
+								Type:  BrowserMatchTypeSite,
+								Value: "www.example.com",
+							},
+						},
+					},
+				},
+			},
+			url:      "https://www.example.org/",
+			expected: false,
+		},
+		{
+			name: "query without host matches any host",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeQuery,
+						Value: "tenant=acme",
+					},
+				},
+			},
+			url:      "https://login.example.com/?tenant=acme",
+			expected: true,
+		},
+		{
+			name: "query without value matches when the parameter is present",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeQuery,
+						Value: "authuser",
+					},
+				},
+			},
+			url:      "https://docs.google.com/?authuser=1",
+			expected: true,
+		},
+		{
+			name: "query requires all the parameters to match",
+			settings: BrowserSettings{
+				Name:    "Firefox",
+				Command: "firefox",
+				Hidden:  false,
+				Source:  SourceAuto,
+				Matches: []BrowserMatch{
+					{
+						Type:  BrowserMatchTypeQuery,
+						Value: "tenant=acme&prompt=login",
+					},
+				},
+			},
+			url:      "https://login.example.com/?tenant=acme",
+			expected: false,
+		},
 	} {
 		t.Run(
 			tt.name, func(t *testing.T) {
@@ -177,6 +823,22 @@ func TestBrowserSettings_MatchesUrl(t *testing.T) {
 	}
 }
 
+func TestBrowserMatch_JSONIsBackwardCompatible(t *testing.T) {
+	flat := `{"type":"site","value":"www.example.com"}`
+
+	var match BrowserMatch
+	require.NoError(t, json.Unmarshal([]byte(flat), &match))
+	assert.Equal(t, BrowserMatch{Type: BrowserMatchTypeSite, Value: "www.example.com"}, match)
+
+	data, err := json.Marshal(match)
+	require.NoError(t, err)
+	assert.JSONEq(t, flat, string(data))
+
+	compound := `{"type":"domain","value":"atlassian.net","not":[{"type":"site","value":"status.atlassian.net"}]}`
+	require.NoError(t, json.Unmarshal([]byte(compound), &match))
+	assert.Equal(t, []BrowserMatch{{Type: BrowserMatchTypeSite, Value: "status.atlassian.net"}}, match.Not)
+}
+
 func TestSettings_NormalizeBrowsers(t *testing.T) {
 	for _, tt := range [...]struct {
 		name             string
@@ -508,3 +1170,55 @@ func TestSettings_UpdateWithBrowsers(t *testing.T) {
 		)
 	}
 }
+
+func TestSettings_UpdateWithBrowsers_KeepsOtherSettings(t *testing.T) {
+	settings := &Settings{
+		LogLevel:   "debug",
+		Resolution: ResolutionMostSpecific,
+		Plugins:    []PluginSettings{{Path: "unwrap.so"}},
+		Ui:         UiSettings{HideKeyboardGuideLabel: true},
+	}
+
+	updated := settings.UpdateWithBrowsers([]Browser{{Name: "Firefox", Command: "firefox %u"}})
+
+	assert.Equal(t, "debug", updated.LogLevel)
+	assert.Equal(t, ResolutionMostSpecific, updated.Resolution)
+	assert.Equal(t, settings.Plugins, updated.Plugins)
+	assert.Equal(t, settings.Ui, updated.Ui)
+	assert.Len(t, updated.Browsers, 1)
+}
+
+func TestSettings_TemporaryRules(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time { return now })
+
+	settings := &Settings{
+		Browsers: []BrowserSettings{
+			{Name: "Sandbox", Command: "firejail firefox %u"},
+			{Name: "Firefox", Command: "firefox %u", Matches: []BrowserMatch{{Type: BrowserMatchTypeDomain, Value: "example.com"}}},
+		},
+		Environment: MatchEnvironment{Clock: clock},
+	}
+
+	settings.AddTemporaryRuleToBrowser(&Browser{Command: "firejail firefox %u"}, BrowserMatchTypeSite, "vendor.example.com", 7*24*time.Hour)
+
+	rule := settings.Browsers[0].Matches[0]
+	require.NotNil(t, rule.ExpiresAt)
+	assert.Equal(t, now.Add(7*24*time.Hour), *rule.ExpiresAt)
+
+	// the temporary rule wins over the domain-rule of the later browser until it expires
+	browser, err := settings.GetMatchingBrowser("https://vendor.example.com/portal")
+	require.NoError(t, err)
+	assert.Equal(t, "Sandbox", browser.Name)
+
+	now = now.Add(7 * 24 * time.Hour)
+
+	browser, err = settings.GetMatchingBrowser("https://vendor.example.com/portal")
+	require.NoError(t, err)
+	assert.Equal(t, "Firefox", browser.Name)
+
+	assert.Equal(t, 0, settings.RemoveExpiredRules(now.Add(-time.Second)))
+	assert.Equal(t, 1, settings.RemoveExpiredRules(now))
+	assert.Empty(t, settings.Browsers[0].Matches)
+	assert.Len(t, settings.Browsers[1].Matches, 1)
+}
@@ -0,0 +1,43 @@
+package linkquisition
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// SourceApp describes the application which launched Linkquisition, i.e. where the link was clicked
+type SourceApp struct {
+	// DesktopFile is the path or the id of the .desktop -file the application was launched with, if known
+	DesktopFile string
+
+	// Processes lists the names of the ancestor processes, starting from the parent process
+	Processes []string
+}
+
+// SourceAppDetector finds out which application launched Linkquisition
+type SourceAppDetector interface {
+	DetectSourceApp() (*SourceApp, error)
+}
+
+// Is returns true if the given name refers to the application: either its .desktop -file (with or without the
+// `.desktop` -suffix) or the name of any of the ancestor processes, case-insensitively
+func (a *SourceApp) Is(name string) bool {
+	if a == nil || name == "" {
+		return false
+	}
+
+	if a.DesktopFile != "" {
+		desktopFile := filepath.Base(a.DesktopFile)
+		if strings.EqualFold(desktopFile, name) || strings.EqualFold(strings.TrimSuffix(desktopFile, ".desktop"), name) {
+			return true
+		}
+	}
+
+	for _, process := range a.Processes {
+		if strings.EqualFold(process, name) {
+			return true
+		}
+	}
+
+	return false
+}
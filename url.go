@@ -1,12 +1,22 @@
 package linkquisition
 
 import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
 	"net/url"
-	"regexp"
+	"slices"
+	"strings"
 
+	"golang.org/x/net/idna"
 	"golang.org/x/net/publicsuffix"
 )
 
+var ErrNoHost = errors.New("url has no host")
+var ErrNoDomain = errors.New("host has no registrable domain")
+
 type URL struct {
 	url string
 }
@@ -15,19 +25,108 @@ func NewURL(u string) *URL {
 	return &URL{url: u}
 }
 
+// NormalizeHost returns the canonical form of a host used in matching: lower-case, internationalized names in their
+// ASCII (punycode) form, IPv6 addresses without the brackets and no trailing dot
+func NormalizeHost(host string) string {
+	host = strings.TrimSuffix(host, ".")
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.String()
+	}
+
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+
+	// names the strict profile refuses, such as ones with underscores, are still converted label by label
+	if ascii, err := idna.Punycode.ToASCII(strings.ToLower(host)); err == nil {
+		return ascii
+	}
+
+	return strings.ToLower(host)
+}
+
+// normalizeSite returns the canonical form of a site given in a rule, which may also have a port: `bücher.de:8080`
+// becomes `xn--bcher-kva.de:8080` and `[::1]:8080` stays as is
+func normalizeSite(site string) string {
+	if host, port, err := net.SplitHostPort(site); err == nil {
+		return net.JoinHostPort(NormalizeHost(host), port)
+	}
+
+	return NormalizeHost(site)
+}
+
+// matchesSite returns true if the URL has the given (normalized) site, with or without the port
+func matchesSite(site string, u *url.URL) bool {
+	host := NormalizeHost(u.Hostname())
+
+	return site == host || (u.Port() != "" && site == net.JoinHostPort(host, u.Port()))
+}
+
+func (u URL) parse() (*url.URL, error) {
+	return url.Parse(u.url)
+}
+
+// GetHost returns the normalized host of the URL without the userinfo and the port, or an empty string if the URL has
+// no host
+func (u URL) GetHost() (string, error) {
+	parsedUrl, err := u.parse()
+	if err != nil {
+		return "", err
+	}
+
+	if parsedUrl.Hostname() == "" {
+		return "", nil
+	}
+
+	return NormalizeHost(parsedUrl.Hostname()), nil
+}
+
+// GetPort returns the port given in the URL, or an empty string if the URL uses the default port of its scheme
+func (u URL) GetPort() string {
+	parsedUrl, err := u.parse()
+	if err != nil {
+		return ""
+	}
+
+	return parsedUrl.Port()
+}
+
+// GetDomain returns the registrable domain of the host, e.g. `example.co.uk` for `www.example.co.uk`. Both the ICANN
+// and the private public suffixes are honored, so `someone.github.io` is a domain of its own. IP addresses and
+// single-label hosts such as `localhost` are returned as they are.
 func (u URL) GetDomain() (string, error) {
-	parsedUrl, err := url.Parse(u.url)
+	return u.getDomain(false)
+}
+
+// GetIcannDomain returns the registrable domain of the host like GetDomain, but honoring only the ICANN public
+// suffixes: `someone.github.io` belongs to the domain `github.io`
+func (u URL) GetIcannDomain() (string, error) {
+	return u.getDomain(true)
+}
+
+func (u URL) getDomain(icannOnly bool) (string, error) {
+	host, err := u.GetHost()
 	if err != nil {
 		return "", err
 	}
 
-	// If the hostname is an IP address, we return it as is
-	re := regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+$`)
-	if re.MatchString(parsedUrl.Hostname()) {
-		return parsedUrl.Hostname(), nil
+	if host == "" {
+		return "", ErrNoHost
 	}
 
-	tldPlusOne, err := publicsuffix.EffectiveTLDPlusOne(parsedUrl.Hostname())
+	if _, err := netip.ParseAddr(host); err == nil || !strings.Contains(host, ".") {
+		return host, nil
+	}
+
+	if icannOnly {
+		return icannTLDPlusOne(host)
+	}
+
+	tldPlusOne, err := publicsuffix.EffectiveTLDPlusOne(host)
 	if err != nil {
 		return "", err
 	}
@@ -35,12 +134,60 @@ func (u URL) GetDomain() (string, error) {
 	return tldPlusOne, nil
 }
 
+// icannTLDPlusOne returns the ICANN public suffix of the host plus one more label, skipping any private suffixes
+func icannTLDPlusOne(host string) (string, error) {
+	suffix, icann := publicsuffix.PublicSuffix(host)
+	for !icann {
+		_, parent, found := strings.Cut(suffix, ".")
+		if !found {
+			break
+		}
+		suffix, icann = publicsuffix.PublicSuffix(parent)
+	}
+
+	if len(host) <= len(suffix) || host[len(host)-len(suffix)-1] != '.' {
+		return "", fmt.Errorf("%w: `%s` is a public suffix", ErrNoDomain, host)
+	}
+
+	rest := host[:len(host)-len(suffix)-1]
+
+	return rest[strings.LastIndex(rest, ".")+1:] + "." + suffix, nil
+}
+
+// GetSite returns the normalized host of the URL, or an empty string if the URL has no host
 func (u URL) GetSite() (string, error) {
-	re := regexp.MustCompile(`^https?://([^/]+)(/|$)`)
-	match := re.FindStringSubmatch(u.url)
-	if len(match) > 1 {
-		return match[1], nil
+	return u.GetHost()
+}
+
+// GetRuleSuggestions returns the rules the user might want to remember for this URL: the site first, followed by the
+// domain, the first path segment and each of the query parameters
+func (u URL) GetRuleSuggestions() []BrowserMatch {
+	var suggestions []BrowserMatch
+
+	site, err := u.GetSite()
+	if err != nil || site == "" {
+		return nil
+	}
+	suggestions = append(suggestions, BrowserMatch{Type: BrowserMatchTypeSite, Value: site})
+
+	if domain, domainErr := u.GetDomain(); domainErr == nil && domain != site {
+		suggestions = append(suggestions, BrowserMatch{Type: BrowserMatchTypeDomain, Value: domain})
+	}
+
+	parsedUrl, err := u.parse()
+	if err != nil {
+		return suggestions
+	}
+
+	if segment, _, _ := strings.Cut(strings.TrimPrefix(parsedUrl.Path, "/"), "/"); segment != "" {
+		suggestions = append(suggestions, BrowserMatch{Type: BrowserMatchTypePathPrefix, Value: site + "/" + segment})
+	}
+
+	query := parsedUrl.Query()
+	for _, key := range slices.Sorted(maps.Keys(query)) {
+		param := url.Values{key: {query.Get(key)}}
+		suggestions = append(suggestions, BrowserMatch{Type: BrowserMatchTypeQuery, Value: site + "?" + param.Encode()})
 	}
 
-	return "", nil
+	return suggestions
 }